@@ -1,34 +1,93 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"example.com/jsdata/v3/pkg/tsbridge"
 )
 
 var (
 	filename = flag.String("filename", "", "The file to read and send to the backend.")
+	matches  = flag.Bool("matches", false, "Print every match in the file with its line rather than the raw response.")
 )
 
 func main() {
 	flag.Parse()
 
-	bridge := tsbridge.NewBridge("")
+	detector, err := tsbridge.StartDetector(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer detector.Close()
+
+	version, err := detector.Version(context.Background())
+	if err != nil {
+		log.Printf("version handshake failed: %v", err)
+	} else {
+		log.Printf("backend: %v", version)
+	}
 
 	fileContents, err := os.ReadFile(*filename)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	resp, err := bridge.Call(tsbridge.Request{
+	resp, err := detector.CallContext(context.Background(), tsbridge.Request{
 		Filename:     *filename,
 		FileContents: string(fileContents),
+		Kind:         tsbridge.KindOf(*filename),
+		Matches:      *matches,
 	})
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	log.Printf("resp = %+v", resp)
+	if !*matches {
+		log.Printf("resp = %+v", resp)
+		return
+	}
+
+	if resp.Error != "" {
+		log.Fatalf("backend failed to process %s: %s", *filename, resp.Error)
+	}
+
+	for _, match := range resp.Matches {
+		fmt.Printf("%s:%d:%d: %s\n", *filename, match.Line, match.Column, match.Feature)
+		fmt.Printf("\t%s\n\t%s^\n", match.Snippet, indent(match.Snippet, match.Column-1))
+	}
+}
+
+// indent returns whitespace as wide as the first n UTF-16 code units of
+// line, keeping its tabs so a caret after it lines up.
+func indent(line string, n int) string {
+	var b strings.Builder
+
+	for _, r := range line {
+		if n <= 0 {
+			break
+		}
+
+		if r == '\t' {
+			b.WriteRune('\t')
+		} else {
+			b.WriteRune(' ')
+		}
+
+		n--
+		if r >= 0x10000 {
+			n--
+		}
+	}
+
+	// The snippet may stop before the column.
+	if n > 0 {
+		b.WriteString(strings.Repeat(" ", n))
+	}
+
+	return b.String()
 }
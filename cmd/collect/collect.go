@@ -2,29 +2,43 @@ package main
 
 import (
 	"bufio"
-	"encoding/csv"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"path"
+	"runtime"
 	"runtime/pprof"
-	"sort"
 	"strings"
 	"sync"
-	"sync/atomic"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
+	"example.com/jsdata/v3/pkg/blobcache"
+	"example.com/jsdata/v3/pkg/checkpoint"
 	"example.com/jsdata/v3/pkg/common"
+	"example.com/jsdata/v3/pkg/features"
+	"example.com/jsdata/v3/pkg/lockfile"
+	"example.com/jsdata/v3/pkg/metrics"
+	"example.com/jsdata/v3/pkg/pathfilter"
+	"example.com/jsdata/v3/pkg/semver"
 	"example.com/jsdata/v3/pkg/tsbridge"
+	"example.com/jsdata/v3/pkg/tsconfig"
+	"example.com/jsdata/v3/pkg/workspace"
 
 	"github.com/go-git/go-billy/v5/osfs"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/storage/filesystem"
 
@@ -32,22 +46,47 @@ import (
 )
 
 var (
-	repoList   = flag.String("repos", "repos.njson", "A newline delimited JSON file containing a list of repositories to download.")
-	single     = flag.Bool("single", false, "Should a single repository be processed?")
-	cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
+	repoList       = flag.String("repos", "repos.njson", "A newline delimited JSON file containing a list of repositories to download.")
+	single         = flag.Bool("single", false, "Should a single repository be processed?")
+	cpuprofile     = flag.String("cpuprofile", "", "write cpu profile to file")
+	format         = flag.String("format", "csv", "The output format to write per repository (csv or json).")
+	checkpointFile = flag.String("checkpoint", "store/checkpoint.njson", "The journal used to resume an interrupted run. Empty disables checkpointing.")
+	repoWorkers    = flag.Int("repo-workers", runtime.NumCPU(), "The number of repositories to process concurrently.")
+	blobWorkers    = flag.Int("blob-workers", 2*runtime.NumCPU(), "The maximum number of concurrent calls to the backend.")
+	batchSize      = flag.Int("batch-size", 32, "The number of files to send to the backend per request.")
+	metricsAddr    = flag.String("metrics-addr", "", "If set, serve Prometheus metrics on this address at /metrics.")
+	cacheDir       = flag.String("cache", "store/blobcache", "The directory to cache backend results in across runs. Empty disables the cache.")
+
+	pathFilterFile       = flag.String("path-filter", "", "A file of gitignore style rules for paths to skip, added after the built in rules for node_modules/, dist/ and so on.")
+	extensionList        = flag.String("extensions", ".ts,.tsx,.mts,.cts", "A comma separated list of file extensions to analyse.")
+	sinceDate            = flag.String("since", "2020-01-01", "Only collect commits on or after this date (YYYY-MM-DD). Empty means no limit.")
+	untilDate            = flag.String("until", "2023-01-01", "Only collect commits before this date (YYYY-MM-DD). Empty means no limit.")
+	selectStrategy       = flag.String("select", "first-parent", "Which commits to collect: all, first-parent, daily, weekly, monthly or tags.")
+	historyRef           = flag.String("ref", "", "The branch, tag or commit whose history is collected. Empty means the default branch.")
+	includeMergedFlag    = flag.Bool("include-merged", false, "Also collect the commits of branches merged into the first-parent history.")
+	incremental          = flag.Bool("incremental", false, "Diff each commit against the previous one and only look at changed files instead of walking the whole tree.")
+	listFeatures         = flag.Bool("list-features", false, "Print the feature columns with the TypeScript release and syntax of each and exit.")
+	allowVersionMismatch = flag.Bool("allow-version-mismatch", false, "Run even if the backend fails the version handshake, marking every row written as mismatched.")
 )
 
-var counter = make(map[string]uint64)
-var counterMtx sync.Mutex
-var totalCommits uint64
-var globalTsFiles uint64
-
-func count(id string) {
-	counterMtx.Lock()
-	defer counterMtx.Unlock()
-
-	counter[id] += 1
-}
+var (
+	reposTotal     = metrics.NewCounter("collect_repos_total", "Repositories read from the repository list.")
+	reposRemaining = metrics.NewGauge("collect_repos_remaining", "Repositories queued or in progress.")
+	reposOpened    = metrics.NewCounter("collect_repos_opened_total", "Repositories opened or cloned.")
+	reposSucceeded = metrics.NewCounter("collect_repos_succeeded_total", "Repositories processed successfully.")
+	reposFailed    = metrics.NewCounter("collect_repos_failed_total", "Repositories that could not be opened or processed.")
+	reposSkipped   = metrics.NewCounter("collect_repos_skipped_total", "Repositories skipped because the checkpoint marks them done.")
+	commitsTotal   = metrics.NewCounter("collect_commits_total", "Commits visited.")
+	commitErrors   = metrics.NewCounter("collect_commit_errors_total", "Commits that failed to process.")
+	rowsTotal      = metrics.NewCounter("collect_rows_total", "Rows written to the output.")
+	tsFilesTotal   = metrics.NewCounter("collect_typescript_files_total", "TypeScript files analysed, from the cache or the backend.")
+	cacheHits      = metrics.NewCounter("collect_blob_cache_hits_total", "Blobs served from the persistent cache.")
+	cacheMisses    = metrics.NewCounter("collect_blob_cache_misses_total", "Blobs missing from the persistent cache.")
+	parseFailures  = metrics.NewCounter("collect_parse_failures_total", "TypeScript files the backend could not process.")
+	unknownFeature = metrics.NewCounter("collect_unknown_features_total", "Features found in a file that the handshake didn't report, left out of the output.")
+	blobsPerCommit = metrics.NewHistogram("collect_blobs_per_commit", "TypeScript blobs per commit not already seen in an earlier commit.", metrics.ExponentialBuckets(1, 4, 10))
+	commitsPerRepo = metrics.NewHistogram("collect_commits_per_repo", "Commits written per repository.", metrics.ExponentialBuckets(1, 4, 10))
+)
 
 func repoUrlToStore(repoUrl string) (string, error) {
 	parsed, err := url.Parse(repoUrl)
@@ -108,235 +147,816 @@ func parsePackageJson(contents string) (PackageJson, error) {
 	return ret, nil
 }
 
-func getTsVersion(packageJson PackageJson) string {
-	var tsVersion string
-
+// getTsRange returns the range of TypeScript versions packageJson depends
+// on as written.
+func getTsRange(packageJson PackageJson) string {
 	if ver, ok := packageJson.Dependencies["typescript"]; ok {
-		tsVersion = ver
-	} else {
-		if ver, ok := packageJson.DevDependencies["typescript"]; ok {
-			tsVersion = ver
-		}
+		return strings.TrimSpace(ver)
 	}
+	return strings.TrimSpace(packageJson.DevDependencies["typescript"])
+}
 
-	tsVersion = strings.TrimPrefix(tsVersion, " ")
-	tsVersion = strings.TrimPrefix(tsVersion, "~")
-	tsVersion = strings.TrimPrefix(tsVersion, "^")
+// minVersion returns the lowest version in the range or an empty string for
+// ranges without a lower bound, dist tags and other dependencies that aren't
+// ranges.
+func minVersion(tsRange string) string {
+	rng, err := semver.ParseRange(tsRange)
+	if err != nil {
+		return ""
+	}
 
-	return tsVersion
+	min, ok := rng.Min()
+	if !ok {
+		return ""
+	}
+
+	return min.String()
 }
 
 type CommitData struct {
-	Id                string
-	Date              uint64
-	Hash              string
-	PackageName       string
-	PackageVersion    string
+	Id             string
+	Date           uint64
+	Hash           string
+	PackageName    string
+	PackageVersion string
+	// TypeScriptVersion is the version installed according to a lockfile,
+	// or the lowest version TypeScriptRange allows if there isn't one.
 	TypeScriptVersion string
 	Flags             FeatureFlags
+	// Detector identifies the detector and its version from the handshake.
+	Detector string
+	// VersionMismatch is set when the run was allowed to continue despite
+	// the handshake failing.
+	VersionMismatch bool
+	// PackagePath is the directory of the package in a workspace, empty for
+	// the root package.
+	PackagePath string
+	// TypeScriptRange is the TypeScript dependency from package.json.
+	TypeScriptRange string
+	// TypeScriptLockfile is the path of the lockfile TypeScriptVersion was
+	// read from, empty if no lockfile had it.
+	TypeScriptLockfile string
+	// Tsconfig is the package's tsconfig.json, nil if there isn't one.
+	Tsconfig *tsconfig.Config
+	// Ref and Depth say where in the history the commit was found, see
+	// Commit.
+	Ref   string
+	Depth int
 }
 
 type FeatureFlags struct {
 	TotalTypeScriptFiles int
+	// ParseFailures is the number of files the backend could not process.
+	ParseFailures int
+
+	// Occurrences is the number of times each feature appears.
+	Occurrences map[string]int
+	// Files is the number of files each feature appears in.
+	Files map[string]int
+	// Extensions is the number of files analysed with each extension.
+	Extensions map[string]int
+	// DeclarationFiles is the number of .d.ts files, which aren't analysed
+	// or included in the other counts.
+	DeclarationFiles int
+
+	// First is where each feature first appears in a single file. Merge
+	// drops it since it means nothing for more than one file.
+	First map[string]tsbridge.Position
+}
 
-	SatisfiesExpression                bool
-	AccessorKeyword                    bool
-	ExtendsConstraintOnInfer           bool
-	VarianceAnnotationsOnTypeParameter bool
-	TypeModifierOnImportName           bool
-	ImportAssertion                    bool
-	StaticBlockInClass                 bool
-	OverrideOnClassMethod              bool
-	AbstractConstructSignature         bool
-	TemplateLiteralType                bool
-	RemappedNameInMappedType           bool
-	NamedTupleMember                   bool
-	ShortCircuitAssignment             bool
+// mergeCounts returns the sum of a and b.
+func mergeCounts(a map[string]int, b map[string]int) map[string]int {
+	ret := make(map[string]int, len(a)+len(b))
+	for k, v := range a {
+		ret[k] = v
+	}
+	for k, v := range b {
+		ret[k] += v
+	}
+	return ret
+}
+
+// subtractCounts returns a minus b, leaving out counts that reach zero.
+func subtractCounts(a map[string]int, b map[string]int) map[string]int {
+	ret := make(map[string]int, len(a))
+	for k, v := range a {
+		ret[k] = v
+	}
+	for k, v := range b {
+		ret[k] -= v
+		if ret[k] == 0 {
+			delete(ret, k)
+		}
+	}
+	return ret
 }
 
 func (f FeatureFlags) Merge(other *FeatureFlags) FeatureFlags {
 	if other == nil {
 		return f
 	}
+
 	return FeatureFlags{
 		TotalTypeScriptFiles: f.TotalTypeScriptFiles + other.TotalTypeScriptFiles,
+		ParseFailures:        f.ParseFailures + other.ParseFailures,
+		Occurrences:          mergeCounts(f.Occurrences, other.Occurrences),
+		Files:                mergeCounts(f.Files, other.Files),
+		Extensions:           mergeCounts(f.Extensions, other.Extensions),
+		DeclarationFiles:     f.DeclarationFiles + other.DeclarationFiles,
+	}
+}
+
+// Subtract undoes Merge.
+func (f FeatureFlags) Subtract(other *FeatureFlags) FeatureFlags {
+	if other == nil {
+		return f
+	}
 
-		SatisfiesExpression:                f.SatisfiesExpression || other.SatisfiesExpression,
-		AccessorKeyword:                    f.AccessorKeyword || other.AccessorKeyword,
-		ExtendsConstraintOnInfer:           f.ExtendsConstraintOnInfer || other.ExtendsConstraintOnInfer,
-		VarianceAnnotationsOnTypeParameter: f.VarianceAnnotationsOnTypeParameter || other.VarianceAnnotationsOnTypeParameter,
-		TypeModifierOnImportName:           f.TypeModifierOnImportName || other.TypeModifierOnImportName,
-		ImportAssertion:                    f.ImportAssertion || other.ImportAssertion,
-		StaticBlockInClass:                 f.StaticBlockInClass || other.StaticBlockInClass,
-		OverrideOnClassMethod:              f.OverrideOnClassMethod || other.OverrideOnClassMethod,
-		AbstractConstructSignature:         f.AbstractConstructSignature || other.AbstractConstructSignature,
-		TemplateLiteralType:                f.TemplateLiteralType || other.TemplateLiteralType,
-		RemappedNameInMappedType:           f.RemappedNameInMappedType || other.RemappedNameInMappedType,
-		NamedTupleMember:                   f.NamedTupleMember || other.NamedTupleMember,
-		ShortCircuitAssignment:             f.ShortCircuitAssignment || other.ShortCircuitAssignment,
+	return FeatureFlags{
+		TotalTypeScriptFiles: f.TotalTypeScriptFiles - other.TotalTypeScriptFiles,
+		ParseFailures:        f.ParseFailures - other.ParseFailures,
+		Occurrences:          subtractCounts(f.Occurrences, other.Occurrences),
+		Files:                subtractCounts(f.Files, other.Files),
+		Extensions:           subtractCounts(f.Extensions, other.Extensions),
+		DeclarationFiles:     f.DeclarationFiles - other.DeclarationFiles,
 	}
 }
 
-func get(m map[string]bool, name string) bool {
-	v, ok := m[name]
+func (f FeatureFlags) Has(name string) bool {
+	return f.Files[name] > 0
+}
+
+// warnedUnknown holds the unknown features already logged.
+var warnedUnknown sync.Map
+
+// GetFlagsFromResponse converts the backend's response for a single file of
+// the given kind.
+func GetFlagsFromResponse(resp tsbridge.Response, kind string) *FeatureFlags {
+	extensions := map[string]int{kind: 1}
+
+	if resp.Error != "" {
+		return &FeatureFlags{TotalTypeScriptFiles: 1, ParseFailures: 1, Extensions: extensions}
+	}
+
+	flags := &FeatureFlags{
+		TotalTypeScriptFiles: 1,
+		Occurrences:          make(map[string]int, len(resp.Features)),
+		Files:                make(map[string]int, len(resp.Features)),
+		Extensions:           extensions,
+		First:                resp.First,
+	}
+
+	for k := range resp.Features {
+		n := resp.Count(k)
+		if n == 0 {
+			continue
+		}
+
+		// The columns are fixed by the handshake, a feature it didn't
+		// report would shift every column after it in later rows.
+		if _, ok := features.Lookup(k); !ok {
+			unknownFeature.Inc()
+			if _, warned := warnedUnknown.LoadOrStore(k, true); !warned {
+				log.Printf("warning: backend reported unknown feature %s, leaving it out", k)
+			}
+			continue
+		}
+
+		flags.Occurrences[k] = n
+		flags.Files[k] = 1
+	}
+
+	return flags
+}
+
+var detector tsbridge.Detector
+
+// blobCache persists backend responses across repositories and runs. It is
+// nil when caching is disabled.
+var blobCache *blobcache.Cache
+
+var blobs *blobPool
+
+func cachedResponse(hash string) (tsbridge.Response, bool, error) {
+	if blobCache == nil {
+		return tsbridge.Response{}, false, nil
+	}
+
+	resp, ok, err := blobCache.Get(hash)
+	if err != nil {
+		return tsbridge.Response{}, false, err
+	}
 	if ok {
-		return v
+		cacheHits.Inc()
 	} else {
-		return false
+		cacheMisses.Inc()
 	}
+
+	return resp, ok, nil
 }
 
-func GetFlagsFromResponse(resp tsbridge.Response) *FeatureFlags {
-	return &FeatureFlags{
-		TotalTypeScriptFiles:               1,
-		SatisfiesExpression:                get(resp.Features, "SatisfiesExpression"),
-		AccessorKeyword:                    get(resp.Features, "AccessorKeyword"),
-		ExtendsConstraintOnInfer:           get(resp.Features, "ExtendsConstraintOnInfer"),
-		VarianceAnnotationsOnTypeParameter: get(resp.Features, "VarianceAnnotationsOnTypeParameter"),
-		TypeModifierOnImportName:           get(resp.Features, "TypeModifierOnImportName"),
-		ImportAssertion:                    get(resp.Features, "ImportAssertion"),
-		StaticBlockInClass:                 get(resp.Features, "StaticBlockInClass"),
-		OverrideOnClassMethod:              get(resp.Features, "OverrideOnClassMethod"),
-		AbstractConstructSignature:         get(resp.Features, "AbstractConstructSignature"),
-		TemplateLiteralType:                get(resp.Features, "TemplateLiteralType"),
-		RemappedNameInMappedType:           get(resp.Features, "RemappedNameInMappedType"),
-		NamedTupleMember:                   get(resp.Features, "NamedTupleMember"),
-		ShortCircuitAssignment:             get(resp.Features, "ShortCircuitAssignment"),
+func blobRequest(blob *object.Blob, kind string) (tsbridge.Request, error) {
+	reader, err := blob.Reader()
+	if err != nil {
+		return tsbridge.Request{}, err
 	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return tsbridge.Request{}, err
+	}
+
+	return tsbridge.Request{
+		Filename:     blob.Hash.String() + "." + kind,
+		FileContents: string(content),
+		Kind:         kind,
+	}, nil
 }
 
-var bridge = tsbridge.NewBridge("")
+// blobQueue gathers the blobs of a commit that haven't been analysed yet so
+// they can be sent to the backend in batches.
+type blobQueue struct {
+	repo       *git.Repository
+	visitedMap map[string]*FeatureFlags
 
-var ErrPackageJsonNotFound = fmt.Errorf("package.json not found")
+	pending map[string]bool
+	keys    []string
+	kinds   []string
+	reqs    []tsbridge.Request
 
-func collectDataCommit(id string, repo *git.Repository, commit *object.Commit, visitedMap map[string]*FeatureFlags) (CommitData, error) {
-	tree, err := commit.Tree()
+	// analysed is the number of blobs added that weren't seen before.
+	analysed int
+}
+
+func newBlobQueue(repo *git.Repository, visitedMap map[string]*FeatureFlags) *blobQueue {
+	return &blobQueue{
+		repo:       repo,
+		visitedMap: visitedMap,
+		pending:    make(map[string]bool),
+	}
+}
+
+// add queues the blob unless it has been seen before or is in the
+// persistent cache.
+func (q *blobQueue) add(hash plumbing.Hash, kind string) error {
+	key := blobKey(hash.String(), kind)
+	if _, ok := q.visitedMap[key]; ok || q.pending[key] {
+		return nil
+	}
+
+	tsFilesTotal.Inc()
+	q.analysed += 1
+
+	resp, ok, err := cachedResponse(key)
 	if err != nil {
-		return CommitData{}, fmt.Errorf("error fetching tree: %v", err)
+		return err
+	}
+	if ok {
+		q.visitedMap[key] = GetFlagsFromResponse(resp, kind)
+		return nil
 	}
 
-	packageJsonFile, err := tree.File("package.json")
+	blob, err := q.repo.BlobObject(hash)
+	if err == plumbing.ErrObjectNotFound {
+		return nil // Ignore these errors.
+	} else if err != nil {
+		return err
+	}
+
+	req, err := blobRequest(blob, kind)
 	if err != nil {
-		return CommitData{}, ErrPackageJsonNotFound
+		return err
+	}
+
+	q.pending[key] = true
+	q.keys = append(q.keys, key)
+	q.kinds = append(q.kinds, kind)
+	q.reqs = append(q.reqs, req)
+
+	return nil
+}
+
+// run analyses the queued blobs, after which every blob added has an entry
+// in visitedMap.
+func (q *blobQueue) run(ctx context.Context) error {
+	if len(q.reqs) == 0 {
+		return nil
 	}
 
-	pkgContents, err := packageJsonFile.Contents()
+	resps, err := blobs.Analyse(ctx, q.reqs)
 	if err != nil {
-		return CommitData{}, fmt.Errorf("error getting package.json: %v", err)
+		return fmt.Errorf("error analysing files: %v", err)
+	}
+
+	for i, resp := range resps {
+		if blobCache != nil {
+			err := blobCache.Put(q.keys[i], resp)
+			if err != nil {
+				return err
+			}
+		}
+
+		q.visitedMap[q.keys[i]] = GetFlagsFromResponse(resp, q.kinds[i])
+	}
+
+	q.pending = make(map[string]bool)
+	q.keys, q.kinds, q.reqs = nil, nil, nil
+
+	return nil
+}
+
+// backendVersion is the result of the handshake with the backend.
+var backendVersion tsbridge.VersionInfo
+
+// versionMismatch is set when the handshake failed and
+// -allow-version-mismatch let the run continue anyway.
+var versionMismatch bool
+
+// detected holds the features the detector reported in the handshake, nil
+// when it didn't say.
+var detected map[string]bool
+
+// detects reports whether the detector can find a feature, so its absence
+// from a file means the file doesn't use it.
+func detects(name string) bool {
+	return detected == nil || detected[name]
+}
+
+// handshake checks the backend speaks the protocol this build expects and
+// reports every builtin feature. The backend's detectors are registered up
+// front, after which the features and so the columns are fixed for the run.
+func handshake(ctx context.Context) error {
+	v, err := detector.Version(ctx)
+	if errors.Is(err, tsbridge.ErrUnsupported) {
+		err = fmt.Errorf("version mismatch: backend predates the version handshake: %v", err)
+	} else if err != nil {
+		return err
+	} else {
+		expected := features.Names()
+		if v.Native {
+			// Features the native detector can't find are left out on
+			// purpose rather than missing from a stale backend.
+			log.Printf("native detector only detects %s", strings.Join(v.Detectors, ", "))
+			expected = nil
+		}
+
+		err = v.Check(expected)
+
+		detected = make(map[string]bool, len(v.Detectors))
+		for _, name := range v.Detectors {
+			features.Observe(name)
+			detected[name] = true
+		}
 	}
 
-	packageJson, err := parsePackageJson(pkgContents)
 	if err != nil {
-		return CommitData{}, fmt.Errorf("error parsing package.json: %v", err)
+		if !*allowVersionMismatch {
+			return fmt.Errorf("%v (pass -allow-version-mismatch to run anyway)", err)
+		}
+
+		log.Printf("warning: %v, marking every row as mismatched", err)
+		versionMismatch = true
+	}
+
+	backendVersion = v
+	log.Printf("backend: %v", v)
+
+	return nil
+}
+
+// printFeatures writes the features in column order, with the TypeScript
+// release that introduced each and a description of its syntax. Features
+// only the backend knows have neither.
+func printFeatures(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FEATURE\tTYPESCRIPT\tSYNTAX")
+
+	for _, f := range features.All() {
+		version, description := f.Version, f.Description
+		if version == "" {
+			version = "-"
+		}
+		if description == "" {
+			description = "-"
+		}
+		if !detects(f.Name) {
+			description += " (not detected)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", f.Name, version, description)
 	}
 
-	tsVersion := getTsVersion(packageJson)
+	tw.Flush()
+}
+
+var ErrPackageJsonNotFound = fmt.Errorf("package.json not found")
+
+// packageRow holds the package.json fields and configuration written for a
+// package.
+type packageRow struct {
+	Path       string
+	Name       string
+	Version    string
+	TsVersion  string
+	TsRange    string
+	TsLockfile string
+	Tsconfig   *tsconfig.Config
+}
+
+// packageRows reads every package in layout. Packages that don't depend on
+// TypeScript themselves get the root package's version, workspaces usually
+// only install it once at the root.
+func packageRows(tree *object.Tree, layout *workspace.Layout, cache *repoCache) ([]packageRow, error) {
+	rows := make([]packageRow, len(layout.Packages))
 
-	visitBlob := func(blob *object.Blob) (*FeatureFlags, error) {
-		atomic.AddUint64(&globalTsFiles, 1)
+	var root *packageRow
 
-		reader, err := blob.Reader()
+	for i, pkg := range layout.Packages {
+		cfg, err := cache.tsconfigs.Find(tree, pkg.Path)
 		if err != nil {
 			return nil, err
 		}
-		defer reader.Close()
 
-		content, err := io.ReadAll(reader)
+		rows[i] = packageRow{Path: pkg.Path, Name: pkg.Name, Tsconfig: cfg}
+
+		if pkg.PackageJson == "" {
+			continue
+		}
+
+		packageJson, err := parsePackageJson(pkg.PackageJson)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("error parsing %s: %v", path.Join(pkg.Path, "package.json"), err)
 		}
 
-		resp, err := bridge.Call(tsbridge.Request{
-			Filename:     blob.Hash.String() + ".ts",
-			FileContents: string(content),
-		})
+		if packageJson.Name != "" {
+			rows[i].Name = packageJson.Name
+		}
+		rows[i].Version = packageJson.Version
+		rows[i].TsRange = getTsRange(packageJson)
+
+		if rows[i].TsRange != "" {
+			installed, source, err := cache.locks.Resolve(tree, pkg.Path, "typescript", rows[i].TsRange)
+			if err != nil {
+				return nil, fmt.Errorf("error reading lockfile: %v", err)
+			}
+
+			rows[i].TsLockfile = source
+			rows[i].TsVersion = installed
+			if installed == "" {
+				rows[i].TsVersion = minVersion(rows[i].TsRange)
+			}
+		}
+
+		if pkg.Path == "" {
+			root = &rows[i]
+		}
+	}
+
+	for i := range rows {
+		if rows[i].TsRange == "" && root != nil {
+			rows[i].TsVersion = root.TsVersion
+			rows[i].TsRange = root.TsRange
+			rows[i].TsLockfile = root.TsLockfile
+		}
+	}
+
+	return rows, nil
+}
+
+// repoCache holds what is remembered between the commits of a repository.
+type repoCache struct {
+	visited   map[string]*FeatureFlags
+	locks     *lockfile.Resolver
+	tsconfigs *tsconfig.Loader
+	// last is the state after the previous commit in incremental mode.
+	last *incrementalState
+	// introduced are the features whose first use has been recorded.
+	introduced map[string]bool
+	attributes *attributeCache
+}
+
+func newRepoCache(introduced map[string]bool) *repoCache {
+	return &repoCache{
+		visited:    make(map[string]*FeatureFlags),
+		locks:      lockfile.NewResolver(),
+		tsconfigs:  tsconfig.NewLoader(),
+		introduced: introduced,
+		attributes: newAttributeCache(),
+	}
+}
+
+// collectDataCommit returns a row for each package in the commit, the root
+// package first if there is one, and where each feature not seen in an
+// earlier commit is used.
+func collectDataCommit(ctx context.Context, id string, repo *git.Repository, commit *object.Commit, cache *repoCache) ([]CommitData, []FirstUse, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error fetching tree: %v", err)
+	}
+
+	layout, err := workspace.Find(tree)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error finding packages: %v", err)
+	}
+
+	if len(layout.Packages) == 0 {
+		return nil, nil, ErrPackageJsonNotFound
+	}
+
+	packages, err := packageRows(tree, layout, cache)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	filter, filterID, err := commitFilter(repo, tree, cache.attributes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading .gitattributes: %v", err)
+	}
+
+	queue := newBlobQueue(repo, cache.visited)
+
+	// Incremental mode only looks at what changed since the last commit, if
+	// it can't a full walk starts it again.
+	var perPackage []FeatureFlags
+	if *incremental {
+		perPackage, err = cache.last.advance(ctx, tree, filter, filterID, layout, queue)
 		if err != nil {
-			log.Printf("err = %v", err)
-			return nil, err
+			return nil, nil, err
 		}
+	}
+
+	if perPackage == nil {
+		perPackage, err = walkCommit(ctx, repo, tree, filter, filterID, layout, cache, queue)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if *incremental {
+		cache.last = newIncrementalState(tree, filterID, layout, perPackage)
+	}
 
-		flags := GetFlagsFromResponse(resp)
+	blobsPerCommit.Observe(float64(queue.analysed))
 
-		// log.Printf("resp = %+v", resp)
+	date := getCommitDate(commit)
 
-		return flags, nil
+	ret := make([]CommitData, len(packages))
+
+	for i, pkg := range packages {
+		ret[i] = CommitData{
+			Id:                 id,
+			Date:               uint64(date.Unix()),
+			Hash:               commit.Hash.String(),
+			PackageName:        pkg.Name,
+			PackageVersion:     pkg.Version,
+			TypeScriptVersion:  pkg.TsVersion,
+			Flags:              perPackage[i],
+			Detector:           backendVersion.Key(),
+			VersionMismatch:    versionMismatch,
+			PackagePath:        pkg.Path,
+			TypeScriptRange:    pkg.TsRange,
+			TypeScriptLockfile: pkg.TsLockfile,
+			Tsconfig:           pkg.Tsconfig,
+		}
 	}
 
-	var visitTree func(tree *object.Tree) (*FeatureFlags, error)
+	firsts, err := newFirstUses(repo, tree, filter, layout, cache, ret)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error finding first uses: %v", err)
+	}
 
-	visitTree = func(tree *object.Tree) (*FeatureFlags, error) {
-		retFlags := FeatureFlags{}
+	for i := range firsts {
+		firsts[i].Id = id
+		firsts[i].Hash = commit.Hash.String()
+		firsts[i].Date = uint64(date.Unix())
+		firsts[i].Author = commit.Author.Name
+		firsts[i].AuthorEmail = commit.Author.Email
+	}
 
+	return ret, firsts, nil
+}
+
+// newFirstUses finds the features used in rows for the first time in the
+// repository and marks them as introduced.
+func newFirstUses(repo *git.Repository, tree *object.Tree, filter *pathfilter.Filter, layout *workspace.Layout, cache *repoCache, rows []CommitData) ([]FirstUse, error) {
+	var names []string
+	for _, name := range features.Names() {
+		if cache.introduced[name] {
+			continue
+		}
+		for _, row := range rows {
+			if row.Flags.Has(name) {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	found, err := findFirstUses(repo, tree, filter, layout, cache.visited, names)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []FirstUse
+	for _, name := range names {
+		if use, ok := found[name]; ok {
+			ret = append(ret, use)
+			cache.introduced[name] = true
+		}
+	}
+
+	return ret, nil
+}
+
+// walkCommit sums up the features of every file in tree for each package.
+// Subtrees already summed in an earlier commit are reused from the cache
+// without being read.
+func walkCommit(ctx context.Context, repo *git.Repository, tree *object.Tree, filter *pathfilter.Filter, filterID string, layout *workspace.Layout, cache *repoCache, queue *blobQueue) ([]FeatureFlags, error) {
+	visitedMap := cache.visited
+
+	// Find every TypeScript blob in the commit that hasn't been seen before so
+	// they can be sent to the backend in batches.
+	var discover func(tree *object.Tree, dir string) error
+
+	discover = func(tree *object.Tree, dir string) error {
 		for _, ent := range tree.Entries {
-			if flags, ok := visitedMap[ent.Hash.String()]; ok {
-				retFlags = retFlags.Merge(flags)
-				continue
+			filename := path.Join(dir, ent.Name)
+
+			switch ent.Mode {
+			case filemode.Dir:
+				if _, ok := visitedMap[treeKey(ent.Hash, filterID, filename)]; ok || filter.Prune(filename) {
+					continue
+				}
+
+				subtree, err := repo.TreeObject(ent.Hash)
+				if err == plumbing.ErrObjectNotFound {
+					continue // Ignore these errors.
+				} else if err != nil {
+					return err
+				}
+
+				err = discover(subtree, filename)
+				if err != nil {
+					return err
+				}
+			case filemode.Regular, filemode.Deprecated, filemode.Executable:
+				kind, ok := fileKind(ent.Name)
+				if !ok || isDeclaration(ent.Name) || filter.Excluded(filename, false) {
+					continue
+				}
+
+				err := queue.add(ent.Hash, kind)
+				if err != nil {
+					return err
+				}
 			}
+		}
+
+		return nil
+	}
 
-			obj, err := repo.Object(plumbing.AnyObject, ent.Hash)
+	err := discover(tree, "")
+	if err != nil {
+		return nil, fmt.Errorf("error iterating tree: %v", err)
+	}
+
+	err = queue.run(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every TypeScript blob now has an entry in visitedMap so the features
+	// can be summed up the tree.
+	var visitTree func(tree *object.Tree, dir string) (*FeatureFlags, error)
+
+	// entryFlags returns the features of a file or everything inside a
+	// directory.
+	entryFlags := func(ent object.TreeEntry, filename string) (*FeatureFlags, error) {
+		switch ent.Mode {
+		case filemode.Dir:
+			key := treeKey(ent.Hash, filterID, filename)
+
+			if flags, ok := visitedMap[key]; ok {
+				return flags, nil
+			}
+
+			if filter.Prune(filename) {
+				return nil, nil
+			}
+
+			subtree, err := repo.TreeObject(ent.Hash)
 			if err == plumbing.ErrObjectNotFound {
-				continue // Ignore these errors.
+				return nil, nil // Ignore these errors.
 			} else if err != nil {
 				return nil, err
 			}
 
-			var flags *FeatureFlags
+			flags, err := visitTree(subtree, filename)
+			if err != nil {
+				return nil, err
+			}
 
-			switch obj := obj.(type) {
-			case *object.Blob:
-				if strings.HasSuffix(ent.Name, ".ts") {
-					flags, err = visitBlob(obj)
-					if err != nil {
-						return nil, err
-					}
+			visitedMap[key] = flags
+			return flags, nil
+		case filemode.Regular, filemode.Deprecated, filemode.Executable:
+			kind, ok := fileKind(ent.Name)
+			if !ok || filter.Excluded(filename, false) {
+				return nil, nil
+			}
+
+			if isDeclaration(ent.Name) {
+				return &FeatureFlags{DeclarationFiles: 1}, nil
+			}
+
+			return visitedMap[blobKey(ent.Hash.String(), kind)], nil
+		}
+
+		return nil, nil
+	}
+
+	visitTree = func(tree *object.Tree, dir string) (*FeatureFlags, error) {
+		retFlags := FeatureFlags{}
+
+		for _, ent := range tree.Entries {
+			flags, err := entryFlags(ent, path.Join(dir, ent.Name))
+			if err != nil {
+				return nil, err
+			}
+
+			retFlags = retFlags.Merge(flags)
+		}
+
+		return &retFlags, nil
+	}
+
+	// Directories holding a package can't be summed as a whole, their
+	// contents belong to more than one package. Everything else is added to
+	// the package owning the directory it is in.
+	perPackage := make([]FeatureFlags, len(layout.Packages))
+
+	var walkPackages func(tree *object.Tree, dir string, owner int) error
+
+	walkPackages = func(tree *object.Tree, dir string, owner int) error {
+		for _, ent := range tree.Entries {
+			filename := path.Join(dir, ent.Name)
+
+			if ent.Mode == filemode.Dir && layout.Contains(filename) {
+				subtree, err := repo.TreeObject(ent.Hash)
+				if err == plumbing.ErrObjectNotFound {
+					continue // Ignore these errors.
+				} else if err != nil {
+					return err
+				}
+
+				subOwner := owner
+				if layout.IsRoot(filename) {
+					subOwner = layout.Owner(filename)
 				}
-			case *object.Tree:
-				flags, err = visitTree(obj)
+
+				err = walkPackages(subtree, filename, subOwner)
 				if err != nil {
-					return nil, err
+					return err
 				}
-			default:
 				continue
 			}
 
-			if flags != nil {
-				visitedMap[ent.Hash.String()] = flags
-				retFlags = retFlags.Merge(flags)
-			} else {
-				visitedMap[ent.Hash.String()] = nil
+			// Files outside every package when there's no root package.
+			if owner < 0 {
+				continue
 			}
+
+			flags, err := entryFlags(ent, filename)
+			if err != nil {
+				return err
+			}
+
+			perPackage[owner] = perPackage[owner].Merge(flags)
 		}
 
-		return &retFlags, nil
+		return nil
 	}
 
-	flags, err := visitTree(tree)
+	err = walkPackages(tree, "", layout.Owner(""))
 	if err != nil {
-		return CommitData{}, fmt.Errorf("error iterating tree: %v", err)
+		return nil, fmt.Errorf("error iterating tree: %v", err)
 	}
 
-	date := getCommitDate(commit)
-
-	return CommitData{
-		Id:                id,
-		Date:              uint64(date.Unix()),
-		Hash:              commit.Hash.String(),
-		PackageName:       packageJson.Name,
-		PackageVersion:    packageJson.Version,
-		TypeScriptVersion: tsVersion,
-		Flags:             *flags,
-	}, nil
-}
-
-type RepoData struct {
-	Id      string
-	Commits []CommitData
+	return perPackage, nil
 }
 
 type Commit struct {
 	Hash plumbing.Hash
 	Obj  *object.Commit
 	When int64
+	// Ref is the ref the commit was found from, empty with -select all.
+	Ref string
+	// Depth is the number of merges between the commit and the ref's
+	// first-parent history, -1 with -select all.
+	Depth int
 }
 
 type CommitList []Commit
@@ -348,7 +968,13 @@ func (lst *CommitList) Len() int {
 
 // Less implements sort.Interface
 func (lst *CommitList) Less(i int, j int) bool {
-	return (*lst)[i].When < (*lst)[j].When
+	a, b := (*lst)[i], (*lst)[j]
+	// Break ties on the hash so the order is stable between runs, resuming
+	// from a checkpoint depends on it.
+	if a.When == b.When {
+		return a.Hash.String() < b.Hash.String()
+	}
+	return a.When < b.When
 }
 
 // Swap implements sort.Interface
@@ -367,71 +993,113 @@ func getCommitDate(commit *object.Commit) time.Time {
 	}
 }
 
-func collectData(id string, repo *git.Repository) (RepoData, error) {
-	var ret RepoData
+var ErrResumeCommitNotFound = fmt.Errorf("checkpoint commit not found in history")
 
-	visitedMap := make(map[string]*FeatureFlags)
+// collectData calls emit with the rows for each commit in repo in
+// chronological order, along with the first uses of features in the commit
+// and the features it starts or stops using. If resumeAfter is set, commits
+// up to and including it are skipped. introduced holds the features whose
+// first use is already known and adopted the features in use as of
+// resumeAfter, both are updated as commits are collected.
+func collectData(ctx context.Context, id string, repo *git.Repository, resumeAfter string, introduced map[string]bool, adopted *adoption, emit func([]CommitData, []FirstUse, []AdoptionEvent) error) error {
+	cache := newRepoCache(introduced)
 
-	var commitList CommitList
-
-	commitIter, err := repo.CommitObjects()
+	commitList, err := selectCommits(repo)
 	if err != nil {
-		return RepoData{}, err
+		return err
 	}
-	for {
-		commit, err := commitIter.Next()
 
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			return RepoData{}, err
+	if resumeAfter != "" {
+		found := false
+		for i, commit := range commitList {
+			if commit.Hash.String() == resumeAfter {
+				commitList = commitList[i+1:]
+				found = true
+				break
+			}
 		}
-
-		date := getCommitDate(commit)
-
-		// Exclude commits before 2020 or after 2022
-		if date.Year() < 2020 || date.Year() > 2022 {
-			continue
+		if !found {
+			return ErrResumeCommitNotFound
 		}
-
-		commitList = append(commitList, Commit{
-			Hash: commit.Hash,
-			When: date.Unix(),
-			Obj:  commit,
-		})
 	}
 
-	sort.Sort(&commitList)
+	written := 0
 
 	for _, commit := range commitList {
-		atomic.AddUint64(&totalCommits, 1)
+		commitsTotal.Inc()
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
-		commitData, err := collectDataCommit(id, repo, commit.Obj, visitedMap)
+		rows, firsts, err := collectDataCommit(ctx, id, repo, commit.Obj, cache)
 		if err == ErrPackageJsonNotFound {
 			continue
+		} else if ctx.Err() != nil {
+			return ctx.Err()
 		} else if err != nil {
 			log.Printf("error in %s@%s: %v", id, commit.Hash.String()[:8], err)
-			count("collectError")
+			commitErrors.Inc()
 			continue
 		}
 
-		ret.Commits = append(ret.Commits, commitData)
-	}
+		for i := range rows {
+			rows[i].Ref = commit.Ref
+			rows[i].Depth = commit.Depth
+		}
 
-	return ret, nil
-}
+		err = emit(rows, firsts, adopted.advance(id, commit.Obj, rows))
+		if err != nil {
+			return err
+		}
 
-func str(b bool) string {
-	if b {
-		return "1"
-	} else {
-		return "0"
+		written += 1
 	}
+
+	commitsPerRepo.Observe(float64(written))
+
+	return nil
 }
 
 func main() {
 	flag.Parse()
 
+	err := parseExtensions(*extensionList)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = loadFilter(*pathFilterFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = parseSelection(*sinceDate, *untilDate, *selectStrategy, *historyRef, *includeMergedFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Interrupting the run cancels in-flight backend calls. Repositories
+	// that didn't finish are resumed from the checkpoint next time.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	detector, err = tsbridge.StartDetector(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer detector.Close()
+
+	err = handshake(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *listFeatures {
+		printFeatures(os.Stdout)
+		return
+	}
+
 	if *cpuprofile != "" {
 		f, err := os.Create(*cpuprofile)
 		if err != nil {
@@ -441,6 +1109,15 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+
+		go func() {
+			log.Fatal(http.ListenAndServe(*metricsAddr, mux))
+		}()
+	}
+
 	repoList, err := os.Open(*repoList)
 	if err != nil {
 		log.Fatal(err)
@@ -448,16 +1125,32 @@ func main() {
 
 	scan := bufio.NewScanner(repoList)
 
-	visited := make(map[string]bool)
+	var journal *checkpoint.Journal
+	if *checkpointFile != "" {
+		journal, err = checkpoint.Open(*checkpointFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer journal.Close()
+	}
 
-	rows := 0
-	total := 0
-	left := 0
+	// A mismatched backend's results can't be trusted to match anything
+	// already cached under the version it claims, and a cross-check has to
+	// see every file.
+	_, crossCheck := detector.(*tsbridge.CrossCheck)
+	if *cacheDir != "" && !versionMismatch && !crossCheck {
+		blobCache, err = blobcache.Open(*cacheDir, backendVersion.Key())
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	visited := make(map[string]bool)
 
 	if *single {
 		go func() {
 			for {
-				log.Printf("(%d tsFiles, %d commits)", globalTsFiles, totalCommits)
+				log.Printf("(%d tsFiles, %d commits)", tsFilesTotal.Value(), commitsTotal.Value())
 				time.Sleep(250 * time.Millisecond)
 			}
 		}()
@@ -465,98 +1158,219 @@ func main() {
 
 	prog := progressbar.Default(-1)
 
-	var wg sync.WaitGroup
+	blobs = newBlobPool(*blobWorkers, *batchSize)
 
-	for scan.Scan() {
-		var line common.RepoLine
+	err = blobs.probe(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		err := json.Unmarshal(scan.Bytes(), &line)
-		if err != nil {
-			log.Printf("error unmarshaling: %v", err)
-			continue
+	process := func(line common.RepoLine) {
+		id := fmt.Sprintf("%s/%s", line.Login, line.Name)
+
+		defer func() {
+			prog.Add(1)
+			reposRemaining.Dec()
+			prog.Describe(fmt.Sprintf("(%d tsFiles, %d commits, %d/%d left)", tsFilesTotal.Value(), commitsTotal.Value(), reposRemaining.Value(), reposTotal.Value()))
+		}()
+
+		var state checkpoint.RepoState
+		if journal != nil {
+			state = journal.State(id)
 		}
 
-		id := fmt.Sprintf("%s/%s", line.Login, line.Name)
+		// Rows from another detector can't be mixed with this one's, even a
+		// finished repository is collected again from the start.
+		if state.LastCommit != "" && state.Detector != backendVersion.Key() {
+			log.Printf("restarting %s: checkpoint is from detector %q, not %q", id, state.Detector, backendVersion.Key())
 
-		if _, ok := visited[id]; ok {
-			continue
+			err := journal.Reset(id)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			state = checkpoint.RepoState{}
 		}
 
-		visited[id] = true
+		if state.Done {
+			reposSkipped.Inc()
+			return
+		}
 
-		wg.Add(1)
-		total += 1
-		left += 1
+		repo, err := cloneRepo(line.GitUrl)
+		if err != nil {
+			reposFailed.Inc()
+			log.Printf("error opening: %v", err)
+			return
+		}
 
-		go func() {
-			defer func() {
-				prog.Add(1)
-				prog.Describe(fmt.Sprintf("(%d tsFiles, %d commits, %d/%d left)", globalTsFiles, totalCommits, left, total))
-				left -= 1
-				wg.Done()
-			}()
-
-			repo, err := cloneRepo(line.GitUrl)
+		reposOpened.Inc()
+
+		basename := path.Join("store", "output", line.Login+"_"+line.Name)
+
+		collect := func(state checkpoint.RepoState) error {
+			output, err := newOutputWriter(*format, basename, state.Offset)
 			if err != nil {
-				log.Printf("error opening: %v", err)
-				return
+				log.Fatal(err)
 			}
 
-			count("opened")
-
-			commitData, err := collectData(id, repo)
+			provenance, introduced, err := openProvenance(*format, path.Join("store", "provenance", line.Login+"_"+line.Name), state.ProvenanceOffset)
 			if err != nil {
-				count("failure")
-				log.Printf("error collecting data %s/%s: %v", line.Login, line.Name, err)
-				return
+				log.Fatal(err)
 			}
+			defer provenance.Close()
 
-			output, err := os.Create(path.Join("store", "output", line.Login+"_"+line.Name+".csv"))
+			events, adopted, err := openEvents(*format, path.Join("store", "events", line.Login+"_"+line.Name), state.EventsOffset)
 			if err != nil {
 				log.Fatal(err)
 			}
-			defer output.Close()
-
-			csvOutput := csv.NewWriter(output)
-
-			for _, commit := range commitData.Commits {
-				rows += 1
-				err := csvOutput.Write([]string{
-					commit.Id,
-					commit.Hash,
-					commit.PackageName,
-					commit.PackageVersion,
-					commit.TypeScriptVersion,
-					fmt.Sprintf("%d", commit.Date),
-					fmt.Sprintf("%d", commit.Flags.TotalTypeScriptFiles),
-					str(commit.Flags.AccessorKeyword),
-					str(commit.Flags.SatisfiesExpression),
-					str(commit.Flags.ExtendsConstraintOnInfer),
-					str(commit.Flags.VarianceAnnotationsOnTypeParameter),
-					str(commit.Flags.TypeModifierOnImportName),
-					str(commit.Flags.ImportAssertion),
-					str(commit.Flags.StaticBlockInClass),
-					str(commit.Flags.OverrideOnClassMethod),
-					str(commit.Flags.AbstractConstructSignature),
-					str(commit.Flags.TemplateLiteralType),
-					str(commit.Flags.RemappedNameInMappedType),
-					str(commit.Flags.NamedTupleMember),
-					str(commit.Flags.ShortCircuitAssignment),
-				})
+			defer events.Close()
+
+			err = collectData(ctx, id, repo, state.LastCommit, introduced, adopted, func(rows []CommitData, firsts []FirstUse, changes []AdoptionEvent) error {
+				// First uses and events are checkpointed with the commit's
+				// rows, a commit collected again writes them again.
+				for _, use := range firsts {
+					err := provenance.Write(use)
+					if err != nil {
+						return err
+					}
+				}
+
+				for _, event := range changes {
+					err := events.Write(event)
+					if err != nil {
+						return err
+					}
+				}
+
+				for _, row := range rows {
+					rowsTotal.Inc()
+
+					err := output.Write(row)
+					if err != nil {
+						return err
+					}
+				}
+
+				// Every row of a commit is checkpointed together so resuming
+				// never leaves a workspace half written.
+				offset, err := output.Flush()
+				if err != nil {
+					return err
+				}
+
+				provenanceOffset, err := provenance.Size()
+				if err != nil {
+					return err
+				}
+
+				eventsOffset, err := events.Size()
 				if err != nil {
-					log.Fatal(err)
+					return err
 				}
+
+				if journal != nil {
+					return journal.CommitDone(id, checkpoint.RepoState{
+						LastCommit:       rows[0].Hash,
+						Offset:           offset,
+						ProvenanceOffset: provenanceOffset,
+						EventsOffset:     eventsOffset,
+						Detector:         backendVersion.Key(),
+					})
+				}
+				return nil
+			})
+
+			closeErr := output.Close()
+			if err != nil {
+				return err
+			}
+			return closeErr
+		}
+
+		err = collect(state)
+		if err == ErrResumeCommitNotFound {
+			log.Printf("restarting %s: %v", id, err)
+
+			err = journal.Reset(id)
+			if err != nil {
+				log.Fatal(err)
 			}
 
-			csvOutput.Flush()
+			err = collect(checkpoint.RepoState{})
+		}
+		if ctx.Err() != nil {
+			return
+		} else if err != nil {
+			reposFailed.Inc()
+			log.Printf("error collecting data %s/%s: %v", line.Login, line.Name, err)
+			return
+		}
+
+		if journal != nil {
+			err = journal.RepoDone(id)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		reposSucceeded.Inc()
+	}
+
+	// The unbuffered channel means the scanner only reads ahead as fast as
+	// the workers pick up repositories.
+	repos := make(chan common.RepoLine)
+
+	var wg sync.WaitGroup
 
-			count("success")
+	for i := 0; i < *repoWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for line := range repos {
+				process(line)
+			}
 		}()
 	}
 
+scan:
+	for scan.Scan() {
+		var line common.RepoLine
+
+		err := json.Unmarshal(scan.Bytes(), &line)
+		if err != nil {
+			log.Printf("error unmarshaling: %v", err)
+			continue
+		}
+
+		id := fmt.Sprintf("%s/%s", line.Login, line.Name)
+
+		if _, ok := visited[id]; ok {
+			continue
+		}
+
+		visited[id] = true
+
+		// Counted before the send, a worker may finish the repository
+		// before this goroutine runs again.
+		reposRemaining.Inc()
+
+		select {
+		case repos <- line:
+			reposTotal.Inc()
+		case <-ctx.Done():
+			reposRemaining.Dec()
+			break scan
+		}
+	}
+
+	close(repos)
+
 	wg.Wait()
 
-	for k, v := range counter {
-		log.Printf("[C] %s = %d", k, v)
+	if ctx.Err() != nil {
+		log.Printf("interrupted, run again to resume")
 	}
+
+	metrics.WriteSummary(log.Writer())
 }
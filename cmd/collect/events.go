@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"example.com/jsdata/v3/pkg/features"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// The kinds of AdoptionEvent.
+const (
+	eventIntroduced   = "introduced"
+	eventRemoved      = "removed"
+	eventReintroduced = "reintroduced"
+)
+
+// AdoptionEvent records a feature coming into or going out of use in a
+// repository: the commit where it is used and the last one collected wasn't
+// using it, or the other way round.
+type AdoptionEvent struct {
+	Id          string
+	Feature     string
+	Event       string
+	Hash        string
+	Date        uint64
+	Author      string
+	AuthorEmail string
+}
+
+// eventColumns are the names of AdoptionEvent's CSV columns.
+var eventColumns = []string{"Id", "Feature", "Event", "Hash", "Date", "Author", "AuthorEmail"}
+
+func (e AdoptionEvent) fields() []string {
+	return []string{
+		e.Id,
+		e.Feature,
+		e.Event,
+		e.Hash,
+		fmt.Sprintf("%d", e.Date),
+		e.Author,
+		e.AuthorEmail,
+	}
+}
+
+// adoption is which features a repository uses as of the last commit
+// collected.
+type adoption struct {
+	// present is set for the features the last commit uses.
+	present map[string]bool
+	// seen is set for the features any commit so far used.
+	seen map[string]bool
+}
+
+// openEvents opens the event log for a repository, keeping the first offset
+// bytes, and replays the events it already records.
+func openEvents(format string, basename string, offset int64) (*recordLog, *adoption, error) {
+	l, records, err := openRecordLog(format, basename, eventColumns, offset)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	a := &adoption{present: make(map[string]bool), seen: make(map[string]bool)}
+	for _, rec := range records {
+		name := rec["Feature"]
+		a.seen[name] = true
+		a.present[name] = rec["Event"] != eventRemoved
+	}
+
+	return l, a, nil
+}
+
+// advance returns the events between the last commit collected and commit,
+// whose packages have rows, ordered by feature.
+func (a *adoption) advance(id string, commit *object.Commit, rows []CommitData) []AdoptionEvent {
+	names := features.Names()
+
+	// Features only an earlier run saw may not be registered in this one.
+	known := make(map[string]bool, len(names))
+	for _, name := range names {
+		known[name] = true
+	}
+	var extra []string
+	for name := range a.present {
+		if !known[name] {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	names = append(names, extra...)
+
+	var ret []AdoptionEvent
+
+	for _, name := range names {
+		used := false
+		for _, row := range rows {
+			if row.Flags.Has(name) {
+				used = true
+				break
+			}
+		}
+
+		if used == a.present[name] {
+			continue
+		}
+
+		event := eventRemoved
+		if used && a.seen[name] {
+			event = eventReintroduced
+		} else if used {
+			event = eventIntroduced
+		}
+
+		a.present[name] = used
+		a.seen[name] = true
+
+		ret = append(ret, AdoptionEvent{
+			Id:          id,
+			Feature:     name,
+			Event:       event,
+			Hash:        commit.Hash.String(),
+			Date:        uint64(getCommitDate(commit).Unix()),
+			Author:      commit.Author.Name,
+			AuthorEmail: commit.Author.Email,
+		})
+	}
+
+	return ret
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestAdoptionAdvance(t *testing.T) {
+	uses := func(names ...string) []CommitData {
+		files := make(map[string]int)
+		for _, name := range names {
+			files[name] = 1
+		}
+		return []CommitData{{Flags: FeatureFlags{Files: files}}}
+	}
+
+	steps := []struct {
+		rows []CommitData
+		want map[string]string
+	}{
+		{uses(), nil},
+		{uses("SatisfiesExpression"), map[string]string{"SatisfiesExpression": eventIntroduced}},
+		// Another package of the same commit using it counts too.
+		{append(uses("AccessorKeyword"), uses("SatisfiesExpression")...), map[string]string{"AccessorKeyword": eventIntroduced}},
+		{uses("SatisfiesExpression"), map[string]string{"AccessorKeyword": eventRemoved}},
+		{uses(), map[string]string{"SatisfiesExpression": eventRemoved}},
+		{uses(), nil},
+		{uses("SatisfiesExpression", "AccessorKeyword"), map[string]string{"SatisfiesExpression": eventReintroduced, "AccessorKeyword": eventReintroduced}},
+	}
+
+	a := &adoption{present: make(map[string]bool), seen: make(map[string]bool)}
+
+	for i, step := range steps {
+		commit := &object.Commit{
+			Hash:      plumbing.NewHash("0000000000000000000000000000000000000001"),
+			Author:    object.Signature{Name: "A U Thor", Email: "author@example.com", When: time.Unix(1600000000, 0)},
+			Committer: object.Signature{When: time.Unix(1600000000+int64(i), 0)},
+		}
+
+		got := make(map[string]string)
+		for _, event := range a.advance("test/repo", commit, step.rows) {
+			got[event.Feature] = event.Event
+
+			want := AdoptionEvent{
+				Id:          "test/repo",
+				Feature:     event.Feature,
+				Event:       event.Event,
+				Hash:        commit.Hash.String(),
+				Date:        uint64(1600000000 + i),
+				Author:      "A U Thor",
+				AuthorEmail: "author@example.com",
+			}
+			if event != want {
+				t.Errorf("step %d: event = %+v, want %+v", i, event, want)
+			}
+		}
+
+		if step.want == nil {
+			step.want = map[string]string{}
+		}
+		if !reflect.DeepEqual(got, step.want) {
+			t.Errorf("step %d: events = %v, want %v", i, got, step.want)
+		}
+	}
+}
+
+// TestAdoptionResume checks an adoption replayed from the event log carries
+// on where the earlier run stopped.
+func TestAdoptionResume(t *testing.T) {
+	basename := t.TempDir() + "/events"
+
+	l, _, err := openEvents("csv", basename, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range []AdoptionEvent{
+		{Id: "test/repo", Feature: "SatisfiesExpression", Event: eventIntroduced},
+		{Id: "test/repo", Feature: "AccessorKeyword", Event: eventIntroduced},
+	} {
+		err := l.Write(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	offset, err := l.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Written after the last checkpoint, so it is discarded.
+	err = l.Write(AdoptionEvent{Id: "test/repo", Feature: "AccessorKeyword", Event: eventRemoved})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	l, a, err := openEvents("csv", basename, offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	want := map[string]bool{"SatisfiesExpression": true, "AccessorKeyword": true}
+	if !reflect.DeepEqual(a.present, want) || !reflect.DeepEqual(a.seen, want) {
+		t.Errorf("replayed present = %v, seen = %v, want %v", a.present, a.seen, want)
+	}
+
+	size, err := l.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != offset {
+		t.Errorf("Size() = %d after reopening, want %d", size, offset)
+	}
+}
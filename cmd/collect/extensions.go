@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"example.com/jsdata/v3/pkg/tsbridge"
+)
+
+// extensions maps each file extension to analyse, including the dot, to the
+// kind sent to the backend. extensionOrder keeps the order they were given
+// in for the output columns.
+var (
+	extensions     = make(map[string]string)
+	extensionOrder []string
+)
+
+// parseExtensions sets up the extensions to analyse from a comma separated
+// list such as ".ts,.tsx".
+func parseExtensions(list string) error {
+	for _, ext := range strings.Split(list, ",") {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if _, ok := extensions[ext]; ok {
+			continue
+		}
+
+		extensions[ext] = tsbridge.KindOf(ext)
+		extensionOrder = append(extensionOrder, ext)
+	}
+
+	if len(extensionOrder) == 0 {
+		return fmt.Errorf("no extensions to analyse")
+	}
+
+	return nil
+}
+
+// fileKind returns the kind of the file to send to the backend, or false if
+// the file shouldn't be analysed.
+func fileKind(name string) (string, bool) {
+	i := strings.LastIndexByte(name, '.')
+	if i < 0 {
+		return "", false
+	}
+
+	kind, ok := extensions[strings.ToLower(name[i:])]
+	return kind, ok
+}
+
+// blobKey is the key for a blob parsed as kind in visitedMap and the blob
+// cache. The same contents parse differently as TS and TSX so the kind is
+// part of the key, except for plain TS which keeps the bare hash. Entries
+// don't outlive a detector change either way since the blob cache is kept
+// in a directory per backendVersion.Key().
+func blobKey(hash string, kind string) string {
+	if kind == "ts" {
+		return hash
+	}
+	return hash + "." + kind
+}
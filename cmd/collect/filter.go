@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"example.com/jsdata/v3/pkg/pathfilter"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// baseFilter holds the built in rules and those from -path-filter. Each
+// commit adds the rules from its own .gitattributes.
+var baseFilter *pathfilter.Filter
+
+func loadFilter(filename string) error {
+	lines := pathfilter.Defaults
+
+	if filename != "" {
+		extra, err := pathfilter.Load(filename)
+		if err != nil {
+			return err
+		}
+		lines = append(append([]string(nil), lines...), extra...)
+	}
+
+	var err error
+	baseFilter, err = pathfilter.New(lines)
+	if err != nil {
+		return fmt.Errorf("error loading path filter: %v", err)
+	}
+
+	return nil
+}
+
+// attributeFile is a .gitattributes file in the directory dir.
+type attributeFile struct {
+	dir  string
+	hash plumbing.Hash
+}
+
+// attributeCache keeps what commitFilter has found in earlier commits of a
+// repository so unchanged trees aren't searched again.
+type attributeCache struct {
+	// files are the .gitattributes files in each tree, relative to it.
+	files map[plumbing.Hash][]attributeFile
+	// filters are the filters built for each filter id.
+	filters map[string]*pathfilter.Filter
+}
+
+func newAttributeCache() *attributeCache {
+	return &attributeCache{
+		files:   make(map[plumbing.Hash][]attributeFile),
+		filters: make(map[string]*pathfilter.Filter),
+	}
+}
+
+// find returns the .gitattributes files in tree, each directory's before
+// those of the directories inside it.
+func (c *attributeCache) find(repo *git.Repository, tree *object.Tree) ([]attributeFile, error) {
+	if ret, ok := c.files[tree.Hash]; ok {
+		return ret, nil
+	}
+
+	var own, nested []attributeFile
+
+	for _, ent := range tree.Entries {
+		if ent.Mode.IsFile() {
+			if ent.Name == ".gitattributes" {
+				own = append(own, attributeFile{hash: ent.Hash})
+			}
+			continue
+		} else if ent.Mode != filemode.Dir {
+			continue
+		}
+
+		subtree, err := repo.TreeObject(ent.Hash)
+		if err == plumbing.ErrObjectNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		files, err := c.find(repo, subtree)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			nested = append(nested, attributeFile{dir: path.Join(ent.Name, file.dir), hash: file.hash})
+		}
+	}
+
+	ret := append(own, nested...)
+	c.files[tree.Hash] = ret
+
+	return ret, nil
+}
+
+// commitFilter returns the filter for a commit's tree, with the rules of
+// every .gitattributes in it, along with an id that changes whenever any of
+// them does.
+func commitFilter(repo *git.Repository, tree *object.Tree, cache *attributeCache) (*pathfilter.Filter, string, error) {
+	files, err := cache.find(repo, tree)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(files) == 0 {
+		return baseFilter, "", nil
+	}
+
+	h := sha1.New()
+	for _, file := range files {
+		fmt.Fprintf(h, "%s %s\n", file.hash, file.dir)
+	}
+	id := hex.EncodeToString(h.Sum(nil))
+
+	if filter, ok := cache.filters[id]; ok {
+		return filter, id, nil
+	}
+
+	filter := baseFilter
+
+	// Deeper files come later so their rules win, like git.
+	for _, file := range files {
+		blob, err := repo.BlobObject(file.hash)
+		if err == plumbing.ErrObjectNotFound {
+			continue
+		} else if err != nil {
+			return nil, "", err
+		}
+
+		reader, err := blob.Reader()
+		if err != nil {
+			return nil, "", err
+		}
+		contents, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return nil, "", err
+		}
+
+		filter = filter.WithAttributes(file.dir, string(contents))
+	}
+
+	cache.filters[id] = filter
+
+	return filter, id, nil
+}
+
+// treeKey is the key for a tree in visitedMap. Which files are counted
+// depends on where the tree is and the .gitattributes in effect as well as
+// its contents.
+func treeKey(hash plumbing.Hash, filterID string, path string) string {
+	return hash.String() + " " + filterID + " " + path
+}
+
+// isDeclaration reports whether name is a TypeScript declaration file.
+func isDeclaration(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasSuffix(name, ".d.ts") || strings.HasSuffix(name, ".d.mts") || strings.HasSuffix(name, ".d.cts")
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"example.com/jsdata/v3/pkg/pathfilter"
+	"example.com/jsdata/v3/pkg/workspace"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// incrementalState is what -incremental keeps from one commit to the next,
+// enough to update the previous commit's totals from a diff.
+type incrementalState struct {
+	tree     *object.Tree
+	filterID string
+	packages []string
+	totals   []FeatureFlags
+}
+
+func newIncrementalState(tree *object.Tree, filterID string, layout *workspace.Layout, totals []FeatureFlags) *incrementalState {
+	packages := make([]string, len(layout.Packages))
+	for i, pkg := range layout.Packages {
+		packages[i] = pkg.Path
+	}
+
+	return &incrementalState{
+		tree:     tree,
+		filterID: filterID,
+		packages: packages,
+		totals:   totals,
+	}
+}
+
+// compatible reports whether a commit's files are filtered and attributed to
+// packages the same way as the previous commit's, so its totals can be
+// updated rather than recomputed.
+func (s *incrementalState) compatible(filterID string, layout *workspace.Layout) bool {
+	if s == nil || s.filterID != filterID || len(s.packages) != len(layout.Packages) {
+		return false
+	}
+
+	for i, pkg := range layout.Packages {
+		if s.packages[i] != pkg.Path {
+			return false
+		}
+	}
+
+	return true
+}
+
+// advance returns the totals for each package in tree by diffing it against
+// the previous commit's tree, so only changed files are read. The previous
+// commit is the last one collected, with a first-parent walk its parent. It
+// returns nil if there is no previous commit or it isn't compatible.
+func (s *incrementalState) advance(ctx context.Context, tree *object.Tree, filter *pathfilter.Filter, filterID string, layout *workspace.Layout, queue *blobQueue) ([]FeatureFlags, error) {
+	if !s.compatible(filterID, layout) {
+		return nil, nil
+	}
+
+	changes, err := object.DiffTreeWithOptions(ctx, s.tree, tree, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error diffing trees: %v", err)
+	}
+
+	totals := append([]FeatureFlags(nil), s.totals...)
+
+	// tracked returns the package owning a file and its kind, or ok is
+	// false if the file isn't counted.
+	tracked := func(ent object.ChangeEntry) (owner int, kind string, ok bool) {
+		if ent.Name == "" {
+			return 0, "", false
+		}
+
+		switch ent.TreeEntry.Mode {
+		case filemode.Regular, filemode.Deprecated, filemode.Executable:
+		default:
+			return 0, "", false
+		}
+
+		kind, ok = fileKind(ent.TreeEntry.Name)
+		if !ok || filter.Excluded(ent.Name, false) {
+			return 0, "", false
+		}
+
+		owner = layout.Owner(ent.Name)
+		return owner, kind, owner >= 0
+	}
+
+	fileFlags := func(ent object.ChangeEntry, kind string) *FeatureFlags {
+		if isDeclaration(ent.TreeEntry.Name) {
+			return &FeatureFlags{DeclarationFiles: 1}
+		}
+		return queue.visitedMap[blobKey(ent.TreeEntry.Hash.String(), kind)]
+	}
+
+	var added []object.ChangeEntry
+
+	for _, change := range changes {
+		if owner, kind, ok := tracked(change.From); ok {
+			totals[owner] = totals[owner].Subtract(fileFlags(change.From, kind))
+		}
+
+		if _, kind, ok := tracked(change.To); ok {
+			if !isDeclaration(change.To.TreeEntry.Name) {
+				err := queue.add(change.To.TreeEntry.Hash, kind)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			added = append(added, change.To)
+		}
+	}
+
+	err = queue.run(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ent := range added {
+		owner, kind, _ := tracked(ent)
+		totals[owner] = totals[owner].Merge(fileFlags(ent, kind))
+	}
+
+	return totals, nil
+}
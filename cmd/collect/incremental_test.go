@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"example.com/jsdata/v3/pkg/tsbridge"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// setupCollect points collect at the native detector with the default
+// settings.
+func setupCollect(t *testing.T) {
+	t.Helper()
+
+	err := parseExtensions(".ts,.tsx,.mts,.cts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = loadFilter("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = parseSelection("", "", "first-parent", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	detector = tsbridge.NewNativeDetector()
+	err = handshake(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blobCache = nil
+	blobs = newBlobPool(2, 4)
+}
+
+// change is a commit to make in a test repository: files to write, keyed by
+// path, and files to delete.
+type change struct {
+	write  map[string]string
+	remove []string
+}
+
+// makeRepo creates an in-memory repository with a commit for each change,
+// a day apart.
+func makeRepo(t *testing.T, changes []change) *git.Repository {
+	t.Helper()
+
+	fs := memfs.New()
+	repo, err := git.Init(memory.NewStorage(), fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	when := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for i, c := range changes {
+		for name, contents := range c.write {
+			err := util.WriteFile(fs, name, []byte(contents), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = wt.Add(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, name := range c.remove {
+			_, err := wt.Remove(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		sig := &object.Signature{Name: "A U Thor", Email: "author@example.com", When: when.AddDate(0, 0, i)}
+		_, err := wt.Commit("change", &git.CommitOptions{Author: sig, Committer: sig})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return repo
+}
+
+// collectAll returns everything collectData emits for repo.
+func collectAll(t *testing.T, repo *git.Repository) ([]CommitData, []FirstUse, []AdoptionEvent) {
+	t.Helper()
+
+	var rows []CommitData
+	var firsts []FirstUse
+	var events []AdoptionEvent
+
+	adopted := &adoption{present: make(map[string]bool), seen: make(map[string]bool)}
+
+	err := collectData(context.Background(), "test/repo", repo, "", make(map[string]bool), adopted, func(r []CommitData, f []FirstUse, e []AdoptionEvent) error {
+		rows = append(rows, r...)
+		firsts = append(firsts, f...)
+		events = append(events, e...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rows, firsts, events
+}
+
+// TestIncrementalMatchesFullWalk checks -incremental writes the same output
+// as walking every tree across adds, deletes, renames and changes to
+// .gitattributes and the workspace.
+func TestIncrementalMatchesFullWalk(t *testing.T) {
+	setupCollect(t)
+
+	repo := makeRepo(t, []change{
+		{write: map[string]string{
+			"package.json": `{"name":"app","devDependencies":{"typescript":"^4.9.0"}}`,
+			"src/a.ts":     "let a: number | undefined;\na ??= 1;\n",
+			"src/b.ts":     "export const b = { x: 1 } satisfies object;\n",
+			"src/c.tsx":    "export const C = () => <div />;\n",
+		}},
+		{write: map[string]string{
+			"src/a.ts":                "let a = 1;\n",
+			"src/d.ts":                "class D {\n  accessor x = 1;\n  static {}\n}\n",
+			"src/e.d.ts":              "declare const e: number;\n",
+			"node_modules/x/index.ts": "x ||= 1;\n",
+		}},
+		// b.ts is deleted and d.ts renamed.
+		{
+			write:  map[string]string{"lib/d.ts": "class D {\n  accessor x = 1;\n  static {}\n}\n"},
+			remove: []string{"src/b.ts", "src/d.ts"},
+		},
+		{write: map[string]string{".gitattributes": "lib/** linguist-generated\n"}},
+		{write: map[string]string{"src/f.ts": "class F extends G {\n  override m() {}\n}\n"}},
+		{write: map[string]string{
+			"package.json":            `{"name":"app","workspaces":["packages/*"],"devDependencies":{"typescript":"^4.9.0"}}`,
+			"packages/p/package.json": `{"name":"p","devDependencies":{"typescript":"~4.8.0"}}`,
+			"packages/p/index.ts":     "p ||= 2;\n",
+		}},
+		{write: map[string]string{
+			"packages/p/index.ts": "export const p = 2;\n",
+			".gitattributes":      "",
+		}},
+		{remove: []string{"src/f.ts"}},
+	})
+
+	*incremental = false
+	fullRows, fullFirsts, fullEvents := collectAll(t, repo)
+
+	*incremental = true
+	defer func() { *incremental = false }()
+	rows, firsts, events := collectAll(t, repo)
+
+	if len(fullRows) != 11 {
+		t.Fatalf("full walk wrote %d rows, want 11", len(fullRows))
+	}
+
+	for i := range fullRows {
+		if i >= len(rows) {
+			t.Fatalf("incremental wrote %d rows, want %d", len(rows), len(fullRows))
+		}
+		if !reflect.DeepEqual(rows[i], fullRows[i]) {
+			t.Errorf("row %d differs\nincremental: %+v\nfull:        %+v", i, rows[i], fullRows[i])
+		}
+	}
+	if len(rows) != len(fullRows) {
+		t.Errorf("incremental wrote %d rows, want %d", len(rows), len(fullRows))
+	}
+
+	if !reflect.DeepEqual(firsts, fullFirsts) {
+		t.Errorf("first uses differ\nincremental: %+v\nfull:        %+v", firsts, fullFirsts)
+	}
+	if !reflect.DeepEqual(events, fullEvents) {
+		t.Errorf("events differ\nincremental: %+v\nfull:        %+v", events, fullEvents)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"example.com/jsdata/v3/pkg/features"
+	"example.com/jsdata/v3/pkg/tsconfig"
+)
+
+type OutputWriter interface {
+	Write(commit CommitData) error
+	// Flush writes any buffered rows to the file and returns its size.
+	Flush() (int64, error)
+	Close() error
+}
+
+// newOutputWriter creates the writer for format. basename is the output path
+// without an extension. Anything in an existing file past offset is discarded
+// and new rows are appended from there.
+func newOutputWriter(format string, basename string, offset int64) (OutputWriter, error) {
+	var ext string
+
+	switch format {
+	case "csv":
+		ext = ".csv"
+	case "json":
+		ext = ".njson"
+	default:
+		return nil, fmt.Errorf("unknown output format: %s", format)
+	}
+
+	f, err := openAt(basename+ext, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == "csv" {
+		return &csvOutput{f: f, w: csv.NewWriter(f)}, nil
+	} else {
+		return &jsonOutput{f: f, enc: json.NewEncoder(f)}, nil
+	}
+}
+
+func openAt(filename string, offset int64) (*os.File, error) {
+	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	err = f.Truncate(offset)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	_, err = f.Seek(offset, io.SeekStart)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func str(b bool) string {
+	if b {
+		return "1"
+	} else {
+		return "0"
+	}
+}
+
+// detectedValue returns value, or an empty string if the detector can't
+// find the feature.
+func detectedValue(name string, value string) string {
+	if !detects(name) {
+		return ""
+	}
+	return value
+}
+
+// compilerOption returns the value of a tsconfig.json compiler option or an
+// empty string if it isn't set.
+func compilerOption(commit CommitData, name string) string {
+	if commit.Tsconfig == nil {
+		return ""
+	}
+	return commit.Tsconfig.Options[name]
+}
+
+type csvOutput struct {
+	f *os.File
+	w *csv.Writer
+}
+
+// Write implements OutputWriter
+func (o *csvOutput) Write(commit CommitData) error {
+	record := []string{
+		commit.Id,
+		commit.Hash,
+		commit.PackageName,
+		commit.PackageVersion,
+		commit.TypeScriptVersion,
+		fmt.Sprintf("%d", commit.Date),
+		fmt.Sprintf("%d", commit.Flags.TotalTypeScriptFiles),
+	}
+
+	names := features.Names()
+
+	// Features the detector can't find are unknown rather than absent.
+	for _, name := range names {
+		record = append(record, detectedValue(name, str(commit.Flags.Has(name))))
+	}
+	for _, name := range names {
+		record = append(record, detectedValue(name, fmt.Sprintf("%d", commit.Flags.Occurrences[name])))
+	}
+	for _, name := range names {
+		record = append(record, detectedValue(name, fmt.Sprintf("%d", commit.Flags.Files[name])))
+	}
+
+	record = append(record, fmt.Sprintf("%d", commit.Flags.ParseFailures))
+	record = append(record, commit.Detector, str(commit.VersionMismatch))
+
+	for _, ext := range extensionOrder {
+		record = append(record, fmt.Sprintf("%d", commit.Flags.Extensions[extensions[ext]]))
+	}
+
+	record = append(record, fmt.Sprintf("%d", commit.Flags.DeclarationFiles))
+	record = append(record, commit.PackagePath)
+	record = append(record, commit.TypeScriptRange, commit.TypeScriptLockfile)
+
+	if commit.Tsconfig != nil {
+		record = append(record, commit.Tsconfig.Path)
+	} else {
+		record = append(record, "")
+	}
+	for _, name := range tsconfig.Options {
+		record = append(record, compilerOption(commit, name))
+	}
+
+	record = append(record, commit.Ref, fmt.Sprintf("%d", commit.Depth))
+
+	return o.w.Write(record)
+}
+
+// Flush implements OutputWriter
+func (o *csvOutput) Flush() (int64, error) {
+	o.w.Flush()
+	if err := o.w.Error(); err != nil {
+		return 0, err
+	}
+	return o.f.Seek(0, io.SeekCurrent)
+}
+
+// Close implements OutputWriter
+func (o *csvOutput) Close() error {
+	o.w.Flush()
+	if err := o.w.Error(); err != nil {
+		o.f.Close()
+		return err
+	}
+	return o.f.Close()
+}
+
+type jsonCommit struct {
+	Id                   string
+	Hash                 string
+	PackageName          string
+	PackageVersion       string
+	TypeScriptVersion    string
+	Date                 uint64
+	TotalTypeScriptFiles int
+	ParseFailures        int
+	DeclarationFiles     int
+	Features             map[string]bool
+	Occurrences          map[string]int
+	Files                map[string]int
+	Extensions           map[string]int
+	Detector             string
+	VersionMismatch      bool
+	PackagePath          string
+	TypeScriptRange      string
+	TypeScriptLockfile   string
+	Tsconfig             string
+	CompilerOptions      map[string]string
+	Ref                  string
+	Depth                int
+}
+
+type jsonOutput struct {
+	f   *os.File
+	enc *json.Encoder
+}
+
+// Write implements OutputWriter
+func (o *jsonOutput) Write(commit CommitData) error {
+	names := features.Names()
+
+	out := jsonCommit{
+		Id:                   commit.Id,
+		Hash:                 commit.Hash,
+		PackageName:          commit.PackageName,
+		PackageVersion:       commit.PackageVersion,
+		TypeScriptVersion:    commit.TypeScriptVersion,
+		Date:                 commit.Date,
+		TotalTypeScriptFiles: commit.Flags.TotalTypeScriptFiles,
+		ParseFailures:        commit.Flags.ParseFailures,
+		DeclarationFiles:     commit.Flags.DeclarationFiles,
+		Features:             make(map[string]bool, len(names)),
+		Occurrences:          make(map[string]int, len(names)),
+		Files:                make(map[string]int, len(names)),
+		Extensions:           make(map[string]int, len(extensionOrder)),
+		Detector:             commit.Detector,
+		VersionMismatch:      commit.VersionMismatch,
+		PackagePath:          commit.PackagePath,
+		TypeScriptRange:      commit.TypeScriptRange,
+		TypeScriptLockfile:   commit.TypeScriptLockfile,
+		Ref:                  commit.Ref,
+		Depth:                commit.Depth,
+	}
+
+	if commit.Tsconfig != nil {
+		out.Tsconfig = commit.Tsconfig.Path
+		out.CompilerOptions = commit.Tsconfig.Options
+	}
+
+	for _, name := range names {
+		if !detects(name) {
+			continue
+		}
+		out.Features[name] = commit.Flags.Has(name)
+		out.Occurrences[name] = commit.Flags.Occurrences[name]
+		out.Files[name] = commit.Flags.Files[name]
+	}
+	for _, ext := range extensionOrder {
+		out.Extensions[ext] = commit.Flags.Extensions[extensions[ext]]
+	}
+
+	return o.enc.Encode(&out)
+}
+
+// Flush implements OutputWriter
+func (o *jsonOutput) Flush() (int64, error) {
+	return o.f.Seek(0, io.SeekCurrent)
+}
+
+// Close implements OutputWriter
+func (o *jsonOutput) Close() error {
+	return o.f.Close()
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"example.com/jsdata/v3/pkg/tsbridge"
+)
+
+type blobJob struct {
+	ctx   context.Context
+	reqs  []tsbridge.Request
+	resps []tsbridge.Response
+	err   *error
+	wg    *sync.WaitGroup
+}
+
+// blobPool bounds the number of concurrent backend calls across every
+// repository being processed. Submitting blocks once all workers are busy.
+type blobPool struct {
+	jobs      chan blobJob
+	batchSize int
+
+	// noBatch is set once the backend turns out not to support batches.
+	noBatch int32
+}
+
+func newBlobPool(workers int, batchSize int) *blobPool {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	p := &blobPool{jobs: make(chan blobJob), batchSize: batchSize}
+
+	for i := 0; i < workers; i++ {
+		go p.worker()
+	}
+
+	return p
+}
+
+// probe checks once whether the backend answers batches, so a backend
+// without /processBatch doesn't cost a failed round-trip for every batch.
+// Backends from before batches existed answer with an error status or
+// something other than a list of responses.
+func (p *blobPool) probe(ctx context.Context) error {
+	if p.batchSize < 2 {
+		return nil
+	}
+
+	_, err := detector.CallBatchContext(ctx, []tsbridge.Request{{Filename: "probe.ts"}})
+	if errors.Is(err, tsbridge.ErrUnsupported) || errors.Is(err, tsbridge.ErrParseFailed) {
+		atomic.StoreInt32(&p.noBatch, 1)
+		log.Printf("backend doesn't support batches, falling back to one file per call: %v", err)
+		return nil
+	}
+
+	return err
+}
+
+func (p *blobPool) worker() {
+	for job := range p.jobs {
+		*job.err = p.analyseBatch(job.ctx, job.reqs, job.resps)
+		job.wg.Done()
+	}
+}
+
+// analyseBatch fills resps with the backend's responses to reqs. Files the
+// backend fails to process get a response with Error set instead of failing
+// the whole batch.
+func (p *blobPool) analyseBatch(ctx context.Context, reqs []tsbridge.Request, resps []tsbridge.Response) error {
+	if len(reqs) > 1 && atomic.LoadInt32(&p.noBatch) == 0 {
+		got, err := detector.CallBatchContext(ctx, reqs)
+		if err == nil {
+			copy(resps, got)
+			for _, resp := range resps {
+				if resp.Error != "" {
+					parseFailures.Inc()
+				}
+			}
+			return nil
+		}
+
+		if errors.Is(err, tsbridge.ErrUnsupported) {
+			if atomic.CompareAndSwapInt32(&p.noBatch, 0, 1) {
+				log.Printf("backend doesn't support batches, falling back to one file per call: %v", err)
+			}
+		} else if !errors.Is(err, tsbridge.ErrParseFailed) {
+			return err
+		}
+
+		// Either batches aren't supported or the batch as a whole was
+		// rejected, send the files one at a time to find the culprit.
+	}
+
+	for i, req := range reqs {
+		resp, err := detector.CallContext(ctx, req)
+		if errors.Is(err, tsbridge.ErrParseFailed) {
+			// Record the failure against the file instead of failing the
+			// whole commit.
+			parseFailures.Inc()
+			resp, err = tsbridge.Response{Error: err.Error()}, nil
+		}
+		if err != nil {
+			return err
+		}
+
+		resps[i] = resp
+	}
+
+	return nil
+}
+
+// Analyse sends the requests to the backend in batches and returns the
+// responses in the same order. The first error encountered is returned.
+func (p *blobPool) Analyse(ctx context.Context, reqs []tsbridge.Request) ([]tsbridge.Response, error) {
+	resps := make([]tsbridge.Response, len(reqs))
+
+	var batches int
+	for i := 0; i < len(reqs); i += p.batchSize {
+		batches += 1
+	}
+
+	errs := make([]error, batches)
+
+	var wg sync.WaitGroup
+
+submit:
+	for i := 0; i < batches; i++ {
+		start := i * p.batchSize
+		end := start + p.batchSize
+		if end > len(reqs) {
+			end = len(reqs)
+		}
+
+		wg.Add(1)
+
+		select {
+		case p.jobs <- blobJob{ctx: ctx, reqs: reqs[start:end], resps: resps[start:end], err: &errs[i], wg: &wg}:
+		case <-ctx.Done():
+			wg.Done()
+			break submit
+		}
+	}
+
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return resps, nil
+}
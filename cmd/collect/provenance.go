@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"path"
+
+	"example.com/jsdata/v3/pkg/pathfilter"
+	"example.com/jsdata/v3/pkg/workspace"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// FirstUse records where a feature first appeared in a repository: the
+// first commit collected that has it and a file in that commit using it.
+type FirstUse struct {
+	Id          string
+	Feature     string
+	Hash        string
+	Date        uint64
+	Author      string
+	AuthorEmail string
+	Path        string
+	Line        int
+	Column      int
+}
+
+// findFirstUses returns a file in tree using each of names, the first in
+// tree order. Every analysed file must already be in visitedMap.
+func findFirstUses(repo *git.Repository, tree *object.Tree, filter *pathfilter.Filter, layout *workspace.Layout, visitedMap map[string]*FeatureFlags, names []string) (map[string]FirstUse, error) {
+	ret := make(map[string]FirstUse, len(names))
+
+	var walk func(tree *object.Tree, dir string) error
+
+	walk = func(tree *object.Tree, dir string) error {
+		for _, ent := range tree.Entries {
+			if len(ret) == len(names) {
+				return nil
+			}
+
+			filename := path.Join(dir, ent.Name)
+
+			switch ent.Mode {
+			case filemode.Dir:
+				if filter.Prune(filename) {
+					continue
+				}
+
+				subtree, err := repo.TreeObject(ent.Hash)
+				if err == plumbing.ErrObjectNotFound {
+					continue // Ignore these errors.
+				} else if err != nil {
+					return err
+				}
+
+				err = walk(subtree, filename)
+				if err != nil {
+					return err
+				}
+			case filemode.Regular, filemode.Deprecated, filemode.Executable:
+				kind, ok := fileKind(ent.Name)
+				if !ok || isDeclaration(ent.Name) || filter.Excluded(filename, false) || layout.Owner(filename) < 0 {
+					continue
+				}
+
+				flags := visitedMap[blobKey(ent.Hash.String(), kind)]
+				if flags == nil {
+					continue
+				}
+
+				for _, name := range names {
+					if _, ok := ret[name]; ok || !flags.Has(name) {
+						continue
+					}
+
+					pos := flags.First[name]
+					ret[name] = FirstUse{Feature: name, Path: filename, Line: pos.Line, Column: pos.Column}
+				}
+			}
+		}
+
+		return nil
+	}
+
+	err := walk(tree, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// provenanceColumns are the names of FirstUse's CSV columns.
+var provenanceColumns = []string{"Id", "Feature", "Hash", "Date", "Author", "AuthorEmail", "Path", "Line", "Column"}
+
+func (use FirstUse) fields() []string {
+	return []string{
+		use.Id,
+		use.Feature,
+		use.Hash,
+		fmt.Sprintf("%d", use.Date),
+		use.Author,
+		use.AuthorEmail,
+		use.Path,
+		fmt.Sprintf("%d", use.Line),
+		fmt.Sprintf("%d", use.Column),
+	}
+}
+
+// openProvenance opens the provenance log for a repository, keeping the
+// first offset bytes, and returns the features whose first use it already
+// records.
+func openProvenance(format string, basename string, offset int64) (*recordLog, map[string]bool, error) {
+	l, records, err := openRecordLog(format, basename, provenanceColumns, offset)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	seen := make(map[string]bool, len(records))
+	for _, rec := range records {
+		seen[rec["Feature"]] = true
+	}
+
+	return l, seen, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+)
+
+// record is a line of a recordLog.
+type record interface {
+	// fields returns the CSV columns, in the order of the log's columns.
+	fields() []string
+}
+
+// recordLog is a file of records kept alongside a repository's output,
+// appended one per line in the -format of the main output. Records are
+// flushed as they are written so they are on disk before the commit they
+// came from is checkpointed.
+type recordLog struct {
+	f   *os.File
+	csv *csv.Writer
+	enc *json.Encoder
+}
+
+// openRecordLog opens the log at basename. The records in the first offset
+// bytes, those of the commits already checkpointed, are kept and returned
+// keyed by column name. Anything after them is discarded.
+func openRecordLog(format string, basename string, columns []string, offset int64) (*recordLog, []map[string]string, error) {
+	filename := basename + ".csv"
+	if format == "json" {
+		filename = basename + ".njson"
+	}
+
+	err := os.MkdirAll(path.Dir(filename), 0755)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := openAt(filename, offset)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	records, err := readRecords(io.NewSectionReader(f, 0, offset), format, columns)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("error reading %s: %v", filename, err)
+	}
+
+	l := &recordLog{f: f}
+	if format == "json" {
+		l.enc = json.NewEncoder(f)
+	} else {
+		l.csv = csv.NewWriter(f)
+	}
+
+	return l, records, nil
+}
+
+// readRecords returns the records in an existing log.
+func readRecords(r io.Reader, format string, columns []string) ([]map[string]string, error) {
+	contents, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []map[string]string
+
+	if format == "json" {
+		dec := json.NewDecoder(bytes.NewReader(contents))
+		dec.UseNumber()
+		for {
+			var values map[string]interface{}
+			if dec.Decode(&values) != nil {
+				break
+			}
+
+			rec := make(map[string]string, len(values))
+			for k, v := range values {
+				rec[k] = fmt.Sprint(v)
+			}
+			ret = append(ret, rec)
+		}
+	} else {
+		r := csv.NewReader(bytes.NewReader(contents))
+		r.FieldsPerRecord = -1
+		for {
+			fields, err := r.Read()
+			if err != nil {
+				break
+			}
+
+			rec := make(map[string]string, len(columns))
+			for i, name := range columns {
+				if i < len(fields) {
+					rec[name] = fields[i]
+				}
+			}
+			ret = append(ret, rec)
+		}
+	}
+
+	return ret, nil
+}
+
+// Write appends r and flushes it to the file.
+func (l *recordLog) Write(r record) error {
+	if l.enc != nil {
+		return l.enc.Encode(r)
+	}
+
+	err := l.csv.Write(r.fields())
+	if err != nil {
+		return err
+	}
+
+	l.csv.Flush()
+	return l.csv.Error()
+}
+
+// Size returns the size of the file, every record written included.
+func (l *recordLog) Size() (int64, error) {
+	return l.f.Seek(0, io.SeekCurrent)
+}
+
+func (l *recordLog) Close() error {
+	return l.f.Close()
+}
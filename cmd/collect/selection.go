@@ -0,0 +1,325 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// The window of commit dates collected, since is inclusive and until
+// exclusive. A zero time leaves that side open.
+var since, until time.Time
+
+// selection is the -select strategy.
+var selection string
+
+// refName is the -ref to walk, empty for the default branch.
+var refName string
+
+// includeMerged is set to also walk the branches merged into the
+// first-parent history.
+var includeMerged bool
+
+const dateLayout = "2006-01-02"
+
+func parseSelection(sinceFlag string, untilFlag string, selectFlag string, refFlag string, mergedFlag bool) error {
+	var err error
+
+	if sinceFlag != "" {
+		since, err = time.Parse(dateLayout, sinceFlag)
+		if err != nil {
+			return fmt.Errorf("invalid -since: %v", err)
+		}
+	}
+
+	if untilFlag != "" {
+		until, err = time.Parse(dateLayout, untilFlag)
+		if err != nil {
+			return fmt.Errorf("invalid -until: %v", err)
+		}
+	}
+
+	switch selectFlag {
+	case "all", "first-parent", "daily", "weekly", "monthly", "tags":
+		selection = selectFlag
+	default:
+		return fmt.Errorf("unknown -select strategy: %s", selectFlag)
+	}
+
+	refName = refFlag
+	includeMerged = mergedFlag
+
+	return nil
+}
+
+func inWindow(date time.Time) bool {
+	return (since.IsZero() || !date.Before(since)) && (until.IsZero() || date.Before(until))
+}
+
+// selectCommits returns the commits in the date window picked by the
+// -select strategy in chronological order.
+func selectCommits(repo *git.Repository) (CommitList, error) {
+	var commitList CommitList
+	var err error
+
+	switch selection {
+	case "all":
+		commitList, err = allCommits(repo)
+	case "tags":
+		commitList, err = taggedCommits(repo)
+	default:
+		commitList, err = historyCommits(repo)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	inside := commitList[:0]
+	for _, commit := range commitList {
+		if inWindow(time.Unix(commit.When, 0)) {
+			inside = append(inside, commit)
+		}
+	}
+	commitList = inside
+
+	sort.Sort(&commitList)
+
+	switch selection {
+	case "daily":
+		commitList = samplePeriods(commitList, func(t time.Time) string {
+			return t.Format(dateLayout)
+		})
+	case "weekly":
+		commitList = samplePeriods(commitList, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		})
+	case "monthly":
+		commitList = samplePeriods(commitList, func(t time.Time) string {
+			return t.Format("2006-01")
+		})
+	}
+
+	return commitList, nil
+}
+
+func newCommit(commit *object.Commit, ref string, depth int) Commit {
+	return Commit{
+		Hash:  commit.Hash,
+		When:  getCommitDate(commit).Unix(),
+		Obj:   commit,
+		Ref:   ref,
+		Depth: depth,
+	}
+}
+
+// samplePeriods keeps the last commit of each period in a sorted list, the
+// state of the project at the end of the day, week or month.
+func samplePeriods(commitList CommitList, period func(time.Time) string) CommitList {
+	var ret CommitList
+
+	for i, commit := range commitList {
+		key := period(time.Unix(commit.When, 0).UTC())
+		if i+1 < len(commitList) && period(time.Unix(commitList[i+1].When, 0).UTC()) == key {
+			continue
+		}
+		ret = append(ret, commit)
+	}
+
+	return ret
+}
+
+// allCommits returns every commit in the store, including those no ref
+// reaches any more.
+func allCommits(repo *git.Repository) (CommitList, error) {
+	var ret CommitList
+
+	commitIter, err := repo.CommitObjects()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		commit, err := commitIter.Next()
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, newCommit(commit, "", -1))
+	}
+
+	return ret, nil
+}
+
+// resolveRef returns the name and commit of -ref, or of HEAD, which in a
+// fresh clone is the default branch. Branch and tag names don't need their
+// refs/ prefix and anything else git can resolve, like a commit hash, works
+// too.
+func resolveRef(repo *git.Repository) (string, *object.Commit, error) {
+	var name string
+	var hash plumbing.Hash
+
+	if refName == "" {
+		head, err := repo.Head()
+		if err != nil {
+			return "", nil, err
+		}
+		name, hash = head.Name().String(), head.Hash()
+	} else {
+		name = refName
+
+		found := false
+		for _, candidate := range []string{refName, "refs/heads/" + refName, "refs/remotes/origin/" + refName, "refs/tags/" + refName} {
+			ref, err := repo.Reference(plumbing.ReferenceName(candidate), true)
+			if err == nil {
+				name, hash, found = ref.Name().String(), ref.Hash(), true
+				break
+			}
+		}
+
+		if !found {
+			resolved, err := repo.ResolveRevision(plumbing.Revision(refName))
+			if err != nil {
+				return "", nil, fmt.Errorf("error resolving -ref %s: %v", refName, err)
+			}
+			hash = *resolved
+		}
+	}
+
+	// Annotated tags point at a tag object rather than the commit.
+	if tag, err := repo.TagObject(hash); err == nil {
+		commit, err := tag.Commit()
+		if err != nil {
+			return "", nil, err
+		}
+		return name, commit, nil
+	}
+
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return name, commit, nil
+}
+
+// historyCommits walks the first-parent history of the ref, the branch as
+// it was at each point rather than the commits of every branch merged into
+// it. With -include-merged the merged branches are walked too, each commit's
+// depth is the number of merges between it and the first-parent history.
+func historyCommits(repo *git.Repository) (CommitList, error) {
+	ref, tip, err := resolveRef(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret CommitList
+
+	seen := make(map[plumbing.Hash]bool)
+
+	// Each level's walks start from the other parents of merges found by
+	// the one before.
+	level := []*object.Commit{tip}
+
+	for depth := 0; len(level) > 0; depth++ {
+		var merged []*object.Commit
+
+		for _, commit := range level {
+			for commit != nil && !seen[commit.Hash] {
+				seen[commit.Hash] = true
+				ret = append(ret, newCommit(commit, ref, depth))
+
+				// History before the window can't contribute.
+				if !since.IsZero() && getCommitDate(commit).Before(since) {
+					break
+				}
+
+				if len(commit.ParentHashes) == 0 {
+					break
+				}
+
+				if includeMerged {
+					for _, hash := range commit.ParentHashes[1:] {
+						parent, err := repo.CommitObject(hash)
+						if err == plumbing.ErrObjectNotFound {
+							continue
+						} else if err != nil {
+							return nil, err
+						}
+						merged = append(merged, parent)
+					}
+				}
+
+				commit, err = repo.CommitObject(commit.ParentHashes[0])
+				if err == plumbing.ErrObjectNotFound {
+					break // Shallow clones end early.
+				} else if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		level = merged
+	}
+
+	return ret, nil
+}
+
+// taggedCommits returns the commits tags point at, directly or through an
+// annotated tag. Tags on anything but a commit are skipped.
+func taggedCommits(repo *git.Repository) (CommitList, error) {
+	tags, err := repo.Tags()
+	if err != nil {
+		return nil, err
+	}
+	defer tags.Close()
+
+	seen := make(map[plumbing.Hash]bool)
+
+	var ret CommitList
+
+	for {
+		ref, err := tags.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		hash := ref.Hash()
+
+		tag, err := repo.TagObject(hash)
+		if err == nil {
+			commit, err := tag.Commit()
+			if err != nil {
+				continue
+			}
+			hash = commit.Hash
+		} else if err != plumbing.ErrObjectNotFound {
+			return nil, err
+		}
+
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+
+		commit, err := repo.CommitObject(hash)
+		if err == plumbing.ErrObjectNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, newCommit(commit, ref.Name().String(), 0))
+	}
+
+	return ret, nil
+}
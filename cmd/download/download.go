@@ -10,6 +10,9 @@ import (
 	"path"
 	"runtime/pprof"
 	"strings"
+	"time"
+
+	"example.com/jsdata/v3/pkg/metrics"
 
 	"github.com/go-git/go-billy/v5/osfs"
 	git "github.com/go-git/go-git/v5"
@@ -22,6 +25,12 @@ var (
 	cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
 )
 
+var (
+	reposOpened   = metrics.NewCounter("download_repos_opened_total", "Repositories already present in the store.")
+	reposCloned   = metrics.NewCounter("download_repos_cloned_total", "Repositories cloned into the store.")
+	cloneDuration = metrics.NewHistogram("download_clone_duration_seconds", "Time taken to clone a repository.", metrics.ExponentialBuckets(1, 2, 12))
+)
+
 func repoUrlToStore(repoUrl string) (string, error) {
 	parsed, err := url.Parse(repoUrl)
 	if err != nil {
@@ -45,8 +54,10 @@ func cloneRepo(repoUrl string) (*git.Repository, error) {
 		if err != nil {
 			return nil, err
 		}
+		reposOpened.Inc()
 		return repo, nil
 	} else {
+		start := time.Now()
 		repo, err := git.Clone(store, nil, &git.CloneOptions{
 			URL:      strings.Replace(repoUrl, "git://", "https://", 1),
 			Progress: os.Stdout,
@@ -54,6 +65,8 @@ func cloneRepo(repoUrl string) (*git.Repository, error) {
 		if err != nil {
 			return nil, err
 		}
+		cloneDuration.Observe(time.Since(start).Seconds())
+		reposCloned.Inc()
 		return repo, nil
 	}
 }
@@ -102,6 +115,8 @@ func main() {
 		log.Printf("repo = %s/%s", line.Login, line.Name)
 	}
 
+	metrics.WriteSummary(log.Writer())
+
 	// commits, err := repo.CommitObjects()
 	// if err != nil {
 	// 	log.Fatal(err)
@@ -0,0 +1,89 @@
+package blobcache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"example.com/jsdata/v3/pkg/tsbridge"
+)
+
+// Cache stores backend responses on disk keyed by git blob hash. Entries are
+// kept in a directory per backend version so a detector change never returns
+// stale results. The layout mirrors git's loose objects:
+//
+//	<dir>/<version>/<hash[:2]>/<hash[2:]>.json
+type Cache struct {
+	dir string
+}
+
+func Open(dir string, version string) (*Cache, error) {
+	dir = filepath.Join(dir, version)
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cache{dir: dir}, nil
+}
+
+func (c *Cache) path(hash string) string {
+	return filepath.Join(c.dir, hash[:2], hash[2:]+".json")
+}
+
+// Get returns the cached response for the blob hash, if there is one.
+func (c *Cache) Get(hash string) (tsbridge.Response, bool, error) {
+	contents, err := os.ReadFile(c.path(hash))
+	if os.IsNotExist(err) {
+		return tsbridge.Response{}, false, nil
+	} else if err != nil {
+		return tsbridge.Response{}, false, err
+	}
+
+	var resp tsbridge.Response
+
+	err = json.Unmarshal(contents, &resp)
+	if err != nil {
+		// Treat a corrupt entry as a miss, it will be overwritten by Put.
+		return tsbridge.Response{}, false, nil
+	}
+
+	return resp, true, nil
+}
+
+// Put stores resp for the blob hash. The entry is written to a temporary file
+// and renamed into place so concurrent readers never see a partial entry.
+func (c *Cache) Put(hash string, resp tsbridge.Response) error {
+	contents, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	filename := c.path(hash)
+
+	err = os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), ".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(contents)
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
@@ -0,0 +1,191 @@
+package checkpoint
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Entry is a single line in the journal.
+type Entry struct {
+	Repo string
+	// Commit is the hash of the last commit written to the repository output.
+	Commit string `json:",omitempty"`
+	// Offset is the size of the repository output after Commit was written.
+	Offset int64 `json:",omitempty"`
+	// ProvenanceOffset and EventsOffset are the sizes of the repository's
+	// provenance and event logs after Commit was written.
+	ProvenanceOffset int64 `json:",omitempty"`
+	EventsOffset     int64 `json:",omitempty"`
+	// Detector is the key of the detector that found the features of Commit.
+	Detector string `json:",omitempty"`
+	// Done marks the repository as completely processed.
+	Done bool `json:",omitempty"`
+	// Reset discards all earlier progress for the repository.
+	Reset bool `json:",omitempty"`
+}
+
+// RepoState is the progress recorded for a single repository.
+type RepoState struct {
+	Done             bool
+	LastCommit       string
+	Offset           int64
+	ProvenanceOffset int64
+	EventsOffset     int64
+	Detector         string
+}
+
+// Journal is an append-only newline delimited JSON log of collection
+// progress. Replaying the log on Open gives the state of every repository.
+type Journal struct {
+	mtx   sync.Mutex
+	f     *os.File
+	repos map[string]RepoState
+}
+
+func Open(filename string) (*Journal, error) {
+	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &Journal{f: f, repos: make(map[string]RepoState)}
+
+	var valid int64
+
+	scan := bufio.NewScanner(f)
+	scan.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scan.Scan() {
+		var ent Entry
+
+		// A partially written final line is expected if the process was killed
+		// mid-write. Anything after it is discarded.
+		err := json.Unmarshal(scan.Bytes(), &ent)
+		if err != nil {
+			break
+		}
+
+		valid += int64(len(scan.Bytes())) + 1
+
+		j.apply(ent)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// The final entry may be complete but missing its newline.
+	missingNewline := valid > info.Size()
+	if missingNewline {
+		valid = info.Size()
+	}
+
+	err = f.Truncate(valid)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error truncating journal: %v", err)
+	}
+
+	_, err = f.Seek(valid, 0)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if missingNewline {
+		_, err = f.Write([]byte{'\n'})
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	return j, nil
+}
+
+func (j *Journal) apply(ent Entry) {
+	state := j.repos[ent.Repo]
+
+	if ent.Reset {
+		state = RepoState{}
+	}
+	if ent.Commit != "" {
+		state.LastCommit = ent.Commit
+		state.Offset = ent.Offset
+		state.ProvenanceOffset = ent.ProvenanceOffset
+		state.EventsOffset = ent.EventsOffset
+		state.Detector = ent.Detector
+	}
+	if ent.Done {
+		state.Done = true
+	}
+
+	j.repos[ent.Repo] = state
+}
+
+func (j *Journal) append(ent Entry) error {
+	bytes, err := json.Marshal(ent)
+	if err != nil {
+		return err
+	}
+
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	_, err = j.f.Write(append(bytes, '\n'))
+	if err != nil {
+		return err
+	}
+
+	j.apply(ent)
+
+	return nil
+}
+
+// State returns the recorded progress for repo.
+func (j *Journal) State(repo string) RepoState {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	return j.repos[repo]
+}
+
+// CommitDone records that state.LastCommit has been written to the output
+// of repo, which with the logs next to it has the sizes in state.
+func (j *Journal) CommitDone(repo string, state RepoState) error {
+	return j.append(Entry{
+		Repo:             repo,
+		Commit:           state.LastCommit,
+		Offset:           state.Offset,
+		ProvenanceOffset: state.ProvenanceOffset,
+		EventsOffset:     state.EventsOffset,
+		Detector:         state.Detector,
+	})
+}
+
+// RepoDone records that every commit in repo has been processed.
+func (j *Journal) RepoDone(repo string) error {
+	err := j.append(Entry{Repo: repo, Done: true})
+	if err != nil {
+		return err
+	}
+
+	return j.f.Sync()
+}
+
+// Reset forgets any progress for repo so it is processed from scratch.
+func (j *Journal) Reset(repo string) error {
+	return j.append(Entry{Repo: repo, Reset: true})
+}
+
+func (j *Journal) Close() error {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	return j.f.Close()
+}
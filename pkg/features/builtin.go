@@ -0,0 +1,25 @@
+package features
+
+// The order here is the column order of the collector output so it must only
+// ever be appended to.
+var builtin = []Feature{
+	{Name: "AccessorKeyword", Version: "4.9", Description: "accessor modifier on class properties"},
+	{Name: "SatisfiesExpression", Version: "4.9", Description: "expr satisfies Type"},
+	{Name: "ExtendsConstraintOnInfer", Version: "4.7", Description: "infer T extends U in conditional types"},
+	{Name: "VarianceAnnotationsOnTypeParameter", Version: "4.7", Description: "in/out modifiers on type parameters"},
+	{Name: "TypeModifierOnImportName", Version: "4.5", Description: "import { type T } from '...'"},
+	{Name: "ImportAssertion", Version: "4.5", Description: "import ... assert { type: 'json' }"},
+	{Name: "StaticBlockInClass", Version: "4.4", Description: "static { } blocks in classes"},
+	{Name: "OverrideOnClassMethod", Version: "4.3", Description: "override modifier on class methods"},
+	{Name: "AbstractConstructSignature", Version: "4.2", Description: "abstract new () => T"},
+	{Name: "TemplateLiteralType", Version: "4.1", Description: "`prefix${T}` template literal types"},
+	{Name: "RemappedNameInMappedType", Version: "4.1", Description: "{ [K in T as U]: V } key remapping"},
+	{Name: "NamedTupleMember", Version: "4.0", Description: "[name: T] labelled tuple elements"},
+	{Name: "ShortCircuitAssignment", Version: "4.0", Description: "??=, ||= and &&= operators"},
+}
+
+func init() {
+	for _, f := range builtin {
+		Register(f)
+	}
+}
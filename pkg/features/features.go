@@ -0,0 +1,94 @@
+package features
+
+import "sync"
+
+// Feature describes a TypeScript language feature reported by the analysis
+// backend.
+type Feature struct {
+	// Name is the key the backend uses in tsbridge.Response.Features.
+	Name string
+	// Version is the TypeScript release that introduced the feature.
+	Version string
+	// Description is a short human readable summary of the syntax.
+	Description string
+}
+
+var (
+	registry    []Feature
+	registryIdx = make(map[string]int)
+	registryMtx sync.RWMutex
+)
+
+// Register adds a feature to the registry. Registering a name a second time
+// replaces the metadata but keeps the original position.
+func Register(f Feature) {
+	registryMtx.Lock()
+	defer registryMtx.Unlock()
+
+	if i, ok := registryIdx[f.Name]; ok {
+		registry[i] = f
+		return
+	}
+
+	registryIdx[f.Name] = len(registry)
+	registry = append(registry, f)
+}
+
+// Observe makes sure a feature name returned by the backend is known to the
+// registry. Unknown names are appended without any metadata so new detectors
+// show up in the output without code changes. It reports whether the name was
+// newly added.
+func Observe(name string) bool {
+	registryMtx.RLock()
+	_, ok := registryIdx[name]
+	registryMtx.RUnlock()
+	if ok {
+		return false
+	}
+
+	registryMtx.Lock()
+	defer registryMtx.Unlock()
+
+	if _, ok := registryIdx[name]; ok {
+		return false
+	}
+
+	registryIdx[name] = len(registry)
+	registry = append(registry, Feature{Name: name})
+
+	return true
+}
+
+// Lookup returns the registered metadata for name.
+func Lookup(name string) (Feature, bool) {
+	registryMtx.RLock()
+	defer registryMtx.RUnlock()
+
+	i, ok := registryIdx[name]
+	if !ok {
+		return Feature{}, false
+	}
+	return registry[i], true
+}
+
+// All returns every registered feature in registration order.
+func All() []Feature {
+	registryMtx.RLock()
+	defer registryMtx.RUnlock()
+
+	ret := make([]Feature, len(registry))
+	copy(ret, registry)
+	return ret
+}
+
+// Names returns the name of every registered feature in registration order.
+func Names() []string {
+	registryMtx.RLock()
+	defer registryMtx.RUnlock()
+
+	ret := make([]string, len(registry))
+	for i, f := range registry {
+		ret[i] = f.Name
+	}
+	return ret
+}
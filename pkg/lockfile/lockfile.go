@@ -0,0 +1,170 @@
+package lockfile
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+
+	"example.com/jsdata/v3/pkg/semver"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// names are the lockfiles understood, in the order they are looked for in
+// each directory.
+var names = []string{"package-lock.json", "npm-shrinkwrap.json", "pnpm-lock.yaml", "yarn.lock"}
+
+// lock is a parsed lockfile.
+type lock interface {
+	// version returns the version of name installed for the package at
+	// pkgPath, relative to the lockfile's directory, which declared it with
+	// the given range. It returns an empty string if the lockfile doesn't
+	// say.
+	version(pkgPath string, name string, declared string) string
+}
+
+// Resolver finds installed versions from the lockfiles in a repository's
+// commits. Parsed lockfiles are kept by blob hash since they rarely change
+// between commits. It isn't safe for concurrent use.
+type Resolver struct {
+	locks map[plumbing.Hash]lock
+}
+
+func NewResolver() *Resolver {
+	return &Resolver{locks: make(map[plumbing.Hash]lock)}
+}
+
+// Resolve returns the version of the dependency name installed for the
+// package in dir, declared with the given range, and the path of the
+// lockfile it was found in. Lockfiles are looked for in dir and then each
+// directory above it, workspaces usually have a single lockfile at the root.
+// It returns empty strings if no lockfile has the dependency.
+func (r *Resolver) Resolve(tree *object.Tree, dir string, name string, declared string) (string, string, error) {
+	for d := dir; ; d = parent(d) {
+		for _, lockName := range names {
+			filename := path.Join(d, lockName)
+
+			l, err := r.load(tree, filename)
+			if err != nil {
+				return "", "", err
+			}
+			if l == nil {
+				continue
+			}
+
+			pkgPath := strings.TrimPrefix(strings.TrimPrefix(dir, d), "/")
+
+			if v := clean(l.version(pkgPath, name, declared)); v != "" {
+				return v, filename, nil
+			}
+		}
+
+		if d == "" {
+			return "", "", nil
+		}
+	}
+}
+
+func parent(dir string) string {
+	if i := strings.LastIndexByte(dir, '/'); i >= 0 {
+		return dir[:i]
+	}
+	return ""
+}
+
+// load returns the parsed lockfile at filename or nil if there isn't one or
+// it can't be parsed.
+func (r *Resolver) load(tree *object.Tree, filename string) (lock, error) {
+	ent, err := tree.FindEntry(filename)
+	if err == object.ErrEntryNotFound || err == object.ErrDirectoryNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if !ent.Mode.IsFile() {
+		return nil, nil
+	}
+
+	if l, ok := r.locks[ent.Hash]; ok {
+		return l, nil
+	}
+
+	file, err := tree.TreeEntryFile(ent)
+	if err == plumbing.ErrObjectNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	contents, err := file.Contents()
+	if err != nil {
+		return nil, err
+	}
+
+	var l lock
+
+	switch path.Base(filename) {
+	case "package-lock.json", "npm-shrinkwrap.json":
+		l = parsePackageLock(contents)
+	case "pnpm-lock.yaml":
+		l = parsePnpmLock(contents)
+	case "yarn.lock":
+		l = parseYarnLock(contents)
+	}
+
+	// Broken lockfiles are remembered too so they are only parsed once.
+	r.locks[ent.Hash] = l
+
+	return l, nil
+}
+
+// clean strips pnpm's peer dependency suffixes and returns an empty string
+// for anything that isn't a version.
+func clean(v string) string {
+	if i := strings.IndexAny(v, "_("); i >= 0 {
+		v = v[:i]
+	}
+
+	parsed, err := semver.Parse(v)
+	if err != nil {
+		return ""
+	}
+
+	return parsed.String()
+}
+
+type packageLock struct {
+	// Packages is keyed by install path, such as node_modules/typescript,
+	// from lockfile version 2.
+	Packages map[string]struct {
+		Version string `json:"version"`
+	} `json:"packages"`
+	// Dependencies is the only section in lockfile version 1.
+	Dependencies map[string]struct {
+		Version string `json:"version"`
+	} `json:"dependencies"`
+}
+
+func parsePackageLock(contents string) lock {
+	var l packageLock
+	if json.Unmarshal([]byte(contents), &l) != nil {
+		return nil
+	}
+	return &l
+}
+
+func (l *packageLock) version(pkgPath string, name string, declared string) string {
+	// A workspace package's own copy takes priority over the hoisted one.
+	if pkgPath != "" {
+		if pkg, ok := l.Packages[path.Join(pkgPath, "node_modules", name)]; ok {
+			return pkg.Version
+		}
+	}
+
+	if pkg, ok := l.Packages[path.Join("node_modules", name)]; ok {
+		return pkg.Version
+	}
+
+	return l.Dependencies[name].Version
+}
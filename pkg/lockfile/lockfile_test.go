@@ -0,0 +1,205 @@
+package lockfile
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+func readFixture(t *testing.T, name string) string {
+	t.Helper()
+
+	contents, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(contents)
+}
+
+func TestVersion(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		pkgPath  string
+		declared string
+		want     string
+	}{
+		// A descriptor listed with others, one on its own, and ranges
+		// matched against the locked versions. The ts3 alias of typescript
+		// isn't a typescript@ entry.
+		{"yarn-v1.lock", "", "^4.2.0", "4.2.3"},
+		{"yarn-v1.lock", "", "^4.1.0", "4.2.3"},
+		{"yarn-v1.lock", "", "~3.9.0", "3.9.10"},
+		{"yarn-v1.lock", "", "^4.0.0", "4.2.3"},
+		{"yarn-v1.lock", "", ">=3.0.0 <4.0.0", "3.9.10"},
+		{"yarn-v1.lock", "", "3.8.x", ""},
+		{"yarn-v1.lock", "", "latest", ""},
+
+		{"yarn-berry.lock", "", "^4.9.0", "4.9.4"},
+		{"yarn-berry.lock", "", "^4.8.0", "4.9.4"},
+		{"yarn-berry.lock", "", "latest", "4.9.4"},
+		{"yarn-berry.lock", "", "^5.0.0", ""},
+
+		{"pnpm-v5.yaml", "", "^4.9.4", "4.9.4"},
+		{"pnpm-v5.yaml", "packages/a", "^4.9.4", "4.9.4"},
+
+		{"pnpm-v6.yaml", "", "^5.0.0", "5.0.4"},
+		{"pnpm-v6.yaml", "packages/a", "workspace:*", ""},
+		{"pnpm-v6.yaml", "packages/b", "~4.8.0", "4.8.4"},
+		{"pnpm-v6.yaml", "packages/c", "^5.0.0", ""},
+
+		{"package-lock-v1.json", "", "^3.9.0", "3.9.7"},
+		{"package-lock-v2.json", "", "^4.5.0", "4.5.5"},
+
+		// A workspace package's own copy wins over the hoisted one.
+		{"package-lock-v3.json", "", "^4.9.0", "4.9.4"},
+		{"package-lock-v3.json", "packages/a", "~4.7.0", "4.7.4"},
+		{"package-lock-v3.json", "packages/b", "^4.9.0", "4.9.4"},
+	}
+
+	for _, tt := range tests {
+		contents := readFixture(t, tt.fixture)
+
+		var l lock
+		switch {
+		case strings.HasPrefix(tt.fixture, "yarn"):
+			l = parseYarnLock(contents)
+		case strings.HasPrefix(tt.fixture, "pnpm"):
+			l = parsePnpmLock(contents)
+		default:
+			l = parsePackageLock(contents)
+		}
+		if l == nil {
+			t.Fatalf("%s: failed to parse", tt.fixture)
+		}
+
+		if got := clean(l.version(tt.pkgPath, "typescript", tt.declared)); got != tt.want {
+			t.Errorf("%s: version(%q, typescript, %q) = %q, want %q", tt.fixture, tt.pkgPath, tt.declared, got, tt.want)
+		}
+	}
+}
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		v    string
+		want string
+	}{
+		{"4.9.4", "4.9.4"},
+		{"4.9.4_typescript@4.9.4", "4.9.4"},
+		{"10.9.1(@types/node@18.11.18)(typescript@4.8.4)", "10.9.1"},
+		{"link:../ts", ""},
+		{"npm:typescript@3.8.3", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := clean(tt.v); got != tt.want {
+			t.Errorf("clean(%q) = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
+
+// writeTree stores files, keyed by slash separated path, as a tree and
+// returns its hash.
+func writeTree(t *testing.T, s *memory.Storage, files map[string]string) plumbing.Hash {
+	t.Helper()
+
+	dirs := make(map[string]map[string]string)
+	tree := &object.Tree{}
+
+	for name, contents := range files {
+		if i := strings.IndexByte(name, '/'); i >= 0 {
+			if dirs[name[:i]] == nil {
+				dirs[name[:i]] = make(map[string]string)
+			}
+			dirs[name[:i]][name[i+1:]] = contents
+			continue
+		}
+
+		blob := s.NewEncodedObject()
+		blob.SetType(plumbing.BlobObject)
+		w, err := blob.Writer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(contents))
+		w.Close()
+
+		hash, err := s.SetEncodedObject(blob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: name, Mode: filemode.Regular, Hash: hash})
+	}
+
+	for dir, contents := range dirs {
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: dir, Mode: filemode.Dir, Hash: writeTree(t, s, contents)})
+	}
+
+	sort.Slice(tree.Entries, func(i, j int) bool {
+		return tree.Entries[i].Name < tree.Entries[j].Name
+	})
+
+	obj := s.NewEncodedObject()
+	err := tree.Encode(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := s.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func TestResolve(t *testing.T) {
+	s := memory.NewStorage()
+	tree, err := object.GetTree(s, writeTree(t, s, map[string]string{
+		"package-lock.json":           readFixture(t, "package-lock-v3.json"),
+		"packages/c/yarn.lock":        readFixture(t, "yarn-v1.lock"),
+		"packages/d/pnpm-lock.yaml":   "{",
+		"packages/e/src/package.json": "{}",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dir          string
+		declared     string
+		wantVersion  string
+		wantLockfile string
+	}{
+		{"", "^4.9.0", "4.9.4", "package-lock.json"},
+		{"packages/a", "~4.7.0", "4.7.4", "package-lock.json"},
+		// A lockfile of the package's own comes first, a broken one is
+		// skipped.
+		{"packages/c", "^4.1.0", "4.2.3", "packages/c/yarn.lock"},
+		{"packages/d", "^4.9.0", "4.9.4", "package-lock.json"},
+		{"packages/e/src", "^4.9.0", "4.9.4", "package-lock.json"},
+	}
+
+	r := NewResolver()
+
+	for _, tt := range tests {
+		version, lockfile, err := r.Resolve(tree, tt.dir, "typescript", tt.declared)
+		if err != nil {
+			t.Fatalf("Resolve(%q) error = %v", tt.dir, err)
+		}
+		if version != tt.wantVersion || lockfile != tt.wantLockfile {
+			t.Errorf("Resolve(%q) = %q, %q, want %q, %q", tt.dir, version, lockfile, tt.wantVersion, tt.wantLockfile)
+		}
+	}
+
+	version, lockfile, err := r.Resolve(tree, "packages/c", "react", "^18.0.0")
+	if err != nil || version != "" || lockfile != "" {
+		t.Errorf("Resolve(packages/c, react) = %q, %q, %v, want nothing", version, lockfile, err)
+	}
+}
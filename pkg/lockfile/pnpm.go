@@ -0,0 +1,68 @@
+package lockfile
+
+import (
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// pnpmDependency is a resolved version, a plain string before lockfile
+// version 6 and a mapping with the specifier and version after.
+type pnpmDependency struct {
+	Version string
+}
+
+func (d *pnpmDependency) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		d.Version = node.Value
+		return nil
+	}
+
+	var v struct {
+		Version string `yaml:"version"`
+	}
+	err := node.Decode(&v)
+	d.Version = v.Version
+	return err
+}
+
+type pnpmImporter struct {
+	Dependencies         map[string]pnpmDependency `yaml:"dependencies"`
+	DevDependencies      map[string]pnpmDependency `yaml:"devDependencies"`
+	OptionalDependencies map[string]pnpmDependency `yaml:"optionalDependencies"`
+}
+
+// pnpmLock has an importer for each workspace package keyed by its path, or
+// for a single package before lockfile version 9 the dependencies at the
+// top level.
+type pnpmLock struct {
+	Importers    map[string]pnpmImporter `yaml:"importers"`
+	pnpmImporter `yaml:",inline"`
+}
+
+func parsePnpmLock(contents string) lock {
+	var l pnpmLock
+	if yaml.Unmarshal([]byte(contents), &l) != nil {
+		return nil
+	}
+	return &l
+}
+
+func (l *pnpmLock) version(pkgPath string, name string, declared string) string {
+	importer := l.pnpmImporter
+
+	if l.Importers != nil {
+		if pkgPath == "" {
+			pkgPath = "."
+		}
+		importer = l.Importers[pkgPath]
+	}
+
+	for _, deps := range []map[string]pnpmDependency{importer.Dependencies, importer.DevDependencies, importer.OptionalDependencies} {
+		if dep, ok := deps[name]; ok && !strings.HasPrefix(dep.Version, "link:") {
+			return dep.Version
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,92 @@
+package lockfile
+
+import (
+	"strings"
+
+	"example.com/jsdata/v3/pkg/semver"
+)
+
+// yarnLock maps each descriptor, such as typescript@^4.1.0 or, from yarn 2
+// on, typescript@npm:^4.1.0, to the version it resolved to.
+type yarnLock map[string]string
+
+// parseYarnLock reads both the yarn 1 format and the YAML written by later
+// versions. Only descriptor lines and their version field are needed, which
+// look alike in both.
+func parseYarnLock(contents string) lock {
+	l := make(yarnLock)
+
+	var descriptors []string
+
+	for _, line := range strings.Split(contents, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if line[0] != ' ' {
+			descriptors = descriptors[:0]
+			for _, d := range strings.Split(strings.TrimSuffix(line, ":"), ",") {
+				descriptors = append(descriptors, strings.Trim(strings.TrimSpace(d), `"`))
+			}
+			continue
+		}
+
+		// Only the entry's own fields, not those of nested dependencies.
+		if !strings.HasPrefix(line, "  version") || strings.HasPrefix(line, "   ") {
+			continue
+		}
+
+		v := strings.TrimPrefix(strings.TrimSpace(line), "version")
+		v = strings.Trim(strings.TrimSpace(strings.TrimPrefix(v, ":")), `"'`)
+
+		for _, d := range descriptors {
+			l[d] = v
+		}
+	}
+
+	return l
+}
+
+func (l yarnLock) version(pkgPath string, name string, declared string) string {
+	for _, d := range []string{name + "@" + declared, name + "@npm:" + declared} {
+		if v, ok := l[d]; ok {
+			return v
+		}
+	}
+
+	// The range in package.json may be newer or older than the lockfile,
+	// take the highest locked version it allows.
+	rng, rangeErr := semver.ParseRange(declared)
+
+	var best semver.Version
+	found := ""
+	distinct := make(map[string]bool)
+
+	for d, v := range l {
+		if !strings.HasPrefix(d, name+"@") || strings.HasPrefix(d, name+"@patch:") {
+			continue
+		}
+
+		parsed, err := semver.Parse(v)
+		if err != nil {
+			continue
+		}
+
+		distinct[parsed.String()] = true
+
+		if rangeErr == nil && rng.Contains(parsed) && (found == "" || parsed.Compare(best) > 0) {
+			best, found = parsed, parsed.String()
+		}
+	}
+
+	// Tags like latest can't be matched, but if only one version is locked
+	// it must be the one.
+	if found == "" && rangeErr != nil && len(distinct) == 1 {
+		for v := range distinct {
+			return v
+		}
+	}
+
+	return found
+}
@@ -0,0 +1,295 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+type metric interface {
+	Name() string
+	writeSummary(w io.Writer)
+	writePrometheus(w io.Writer)
+}
+
+var (
+	registry    = make(map[string]metric)
+	registryMtx sync.Mutex
+)
+
+// register returns the metric already registered under name or registers the
+// one returned by create.
+func register(name string, create func() metric) metric {
+	registryMtx.Lock()
+	defer registryMtx.Unlock()
+
+	if m, ok := registry[name]; ok {
+		return m
+	}
+
+	m := create()
+	registry[name] = m
+	return m
+}
+
+func sorted() []metric {
+	registryMtx.Lock()
+	defer registryMtx.Unlock()
+
+	ret := make([]metric, 0, len(registry))
+	for _, m := range registry {
+		ret = append(ret, m)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name() < ret[j].Name()
+	})
+
+	return ret
+}
+
+func writeHeader(w io.Writer, name string, help string, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	name string
+	help string
+	v    uint64
+}
+
+func NewCounter(name string, help string) *Counter {
+	return register(name, func() metric {
+		return &Counter{name: name, help: help}
+	}).(*Counter)
+}
+
+// Name implements metric
+func (c *Counter) Name() string {
+	return c.name
+}
+
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.v, 1)
+}
+
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.v, n)
+}
+
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.v)
+}
+
+func (c *Counter) writeSummary(w io.Writer) {
+	fmt.Fprintf(w, "%s = %d\n", c.name, c.Value())
+}
+
+func (c *Counter) writePrometheus(w io.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	fmt.Fprintf(w, "%s %d\n", c.name, c.Value())
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	name string
+	help string
+	v    int64
+}
+
+func NewGauge(name string, help string) *Gauge {
+	return register(name, func() metric {
+		return &Gauge{name: name, help: help}
+	}).(*Gauge)
+}
+
+// Name implements metric
+func (g *Gauge) Name() string {
+	return g.name
+}
+
+func (g *Gauge) Set(v int64) {
+	atomic.StoreInt64(&g.v, v)
+}
+
+func (g *Gauge) Add(n int64) {
+	atomic.AddInt64(&g.v, n)
+}
+
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+func (g *Gauge) Value() int64 {
+	return atomic.LoadInt64(&g.v)
+}
+
+func (g *Gauge) writeSummary(w io.Writer) {
+	fmt.Fprintf(w, "%s = %d\n", g.name, g.Value())
+}
+
+func (g *Gauge) writePrometheus(w io.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %d\n", g.name, g.Value())
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	name    string
+	help    string
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     uint64 // float64 bits
+}
+
+// NewHistogram creates a histogram with the given upper bounds. A +Inf
+// bucket is always added.
+func NewHistogram(name string, help string, buckets []float64) *Histogram {
+	return register(name, func() metric {
+		b := make([]float64, len(buckets))
+		copy(b, buckets)
+		sort.Float64s(b)
+		return &Histogram{
+			name:    name,
+			help:    help,
+			buckets: b,
+			counts:  make([]uint64, len(b)+1),
+		}
+	}).(*Histogram)
+}
+
+// ExponentialBuckets returns n bucket bounds starting at start with each
+// multiplied by factor.
+func ExponentialBuckets(start float64, factor float64, n int) []float64 {
+	ret := make([]float64, n)
+	for i := range ret {
+		ret[i] = start
+		start *= factor
+	}
+	return ret
+}
+
+// Name implements metric
+func (h *Histogram) Name() string {
+	return h.name
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.count, 1)
+
+	for {
+		old := atomic.LoadUint64(&h.sum)
+		updated := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&h.sum, old, updated) {
+			break
+		}
+	}
+}
+
+func (h *Histogram) Count() uint64 {
+	return atomic.LoadUint64(&h.count)
+}
+
+func (h *Histogram) Sum() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&h.sum))
+}
+
+// Quantile estimates the q-th quantile as the upper bound of the bucket it
+// falls in.
+func (h *Histogram) Quantile(q float64) float64 {
+	total := h.Count()
+	if total == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(q * float64(total)))
+
+	var cumulative uint64
+	for i := range h.counts {
+		cumulative += atomic.LoadUint64(&h.counts[i])
+		if cumulative >= rank {
+			if i == len(h.buckets) {
+				return math.Inf(1)
+			}
+			return h.buckets[i]
+		}
+	}
+
+	return math.Inf(1)
+}
+
+func (h *Histogram) writeSummary(w io.Writer) {
+	count := h.Count()
+
+	var mean float64
+	if count > 0 {
+		mean = h.Sum() / float64(count)
+	}
+
+	fmt.Fprintf(w, "%s count=%d mean=%s p50<=%s p90<=%s p99<=%s\n",
+		h.name, count, formatFloat(mean),
+		formatFloat(h.Quantile(0.5)), formatFloat(h.Quantile(0.9)), formatFloat(h.Quantile(0.99)))
+}
+
+func (h *Histogram) writePrometheus(w io.Writer) {
+	writeHeader(w, h.name, h.help, "histogram")
+
+	var cumulative uint64
+	for i := range h.counts {
+		cumulative += atomic.LoadUint64(&h.counts[i])
+
+		le := math.Inf(1)
+		if i < len(h.buckets) {
+			le = h.buckets[i]
+		}
+
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.name, formatFloat(le), cumulative)
+	}
+
+	fmt.Fprintf(w, "%s_sum %s\n", h.name, formatFloat(h.Sum()))
+	fmt.Fprintf(w, "%s_count %d\n", h.name, h.Count())
+}
+
+// WriteSummary writes a human readable line for every registered metric.
+func WriteSummary(w io.Writer) {
+	for _, m := range sorted() {
+		m.writeSummary(w)
+	}
+}
+
+// WritePrometheus writes every registered metric in the Prometheus text
+// exposition format.
+func WritePrometheus(w io.Writer) {
+	for _, m := range sorted() {
+		m.writePrometheus(w)
+	}
+}
+
+// Handler serves the registered metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		WritePrometheus(w)
+	})
+}
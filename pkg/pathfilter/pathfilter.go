@@ -0,0 +1,270 @@
+package pathfilter
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Defaults are the rules every Filter starts with, directories of
+// dependencies and build output that aren't the project's own code.
+var Defaults = []string{
+	"node_modules/",
+	"bower_components/",
+	"dist/",
+	"build/",
+	"vendor/",
+}
+
+type rule struct {
+	re      *regexp.Regexp
+	dirOnly bool
+	include bool
+	// fileOnly rules come from .gitattributes and, like git attributes,
+	// only match a file's own path, never a directory containing it.
+	fileOnly bool
+	// prefix is the literal start of every path the rule matches, empty
+	// for rules matching at any depth.
+	prefix string
+}
+
+// matches reports whether the rule matches path or any directory containing
+// it.
+func (r rule) matches(path string, isDir bool) bool {
+	if r.fileOnly {
+		return !isDir && !r.dirOnly && r.re.MatchString(path)
+	}
+
+	if (isDir || !r.dirOnly) && r.re.MatchString(path) {
+		return true
+	}
+
+	for i := strings.LastIndexByte(path, '/'); i > 0; i = strings.LastIndexByte(path[:i], '/') {
+		if r.re.MatchString(path[:i]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Filter decides which paths in a repository are scanned. Rules use
+// gitignore syntax and the last rule matching a path or any of its parent
+// directories wins, so unlike git a later ! rule can include files inside an
+// excluded directory.
+type Filter struct {
+	rules []rule
+}
+
+// New creates a filter from gitignore style lines.
+func New(lines []string) (*Filter, error) {
+	f := &Filter{}
+
+	for _, line := range lines {
+		err := f.Add(line)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+// Load reads gitignore style rules from filename, one per line.
+func Load(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var ret []string
+
+	scan := bufio.NewScanner(file)
+	for scan.Scan() {
+		ret = append(ret, scan.Text())
+	}
+
+	return ret, scan.Err()
+}
+
+// Add appends a gitignore style rule. Blank lines and comments are ignored
+// and a leading ! makes the rule include paths instead of excluding them.
+func (f *Filter) Add(line string) error {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	include := false
+	if strings.HasPrefix(line, "!") {
+		include = true
+		line = line[1:]
+	}
+
+	return f.add("", line, include, false)
+}
+
+func (f *Filter) add(base string, pattern string, include bool, fileOnly bool) error {
+	r, err := compile(base, pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+
+	r.include = include
+	r.fileOnly = fileOnly
+	f.rules = append(f.rules, r)
+
+	return nil
+}
+
+// Excluded reports whether path, relative to the repository root and using
+// forward slashes, should be skipped.
+func (f *Filter) Excluded(path string, isDir bool) bool {
+	for i := len(f.rules) - 1; i >= 0; i-- {
+		if f.rules[i].matches(path, isDir) {
+			return !f.rules[i].include
+		}
+	}
+	return false
+}
+
+// Prune reports whether the directory at path and everything inside it can
+// be skipped without looking at its contents.
+func (f *Filter) Prune(path string) bool {
+	return f.Excluded(path, true) && !f.mayInclude(path)
+}
+
+// mayInclude reports whether an include rule might match something inside
+// the directory at path.
+func (f *Filter) mayInclude(path string) bool {
+	dir := path + "/"
+
+	for _, r := range f.rules {
+		if r.include && (strings.HasPrefix(dir, r.prefix) || strings.HasPrefix(r.prefix, dir)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WithAttributes returns a copy of the filter with rules from the
+// .gitattributes file in the directory dir, empty for the root, appended.
+// Like git its patterns are relative to dir and only match files, so
+// generated/ matches nothing and generated/** is needed for a directory's
+// contents. Paths marked linguist-generated or linguist-vendored are
+// excluded and paths where either is unset or false are included,
+// overriding earlier rules.
+func (f *Filter) WithAttributes(dir string, contents string) *Filter {
+	ret := &Filter{
+		rules: append([]rule(nil), f.rules...),
+	}
+
+	for _, line := range strings.Split(contents, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		for _, attr := range fields[1:] {
+			var include bool
+
+			switch attr {
+			case "linguist-generated", "linguist-generated=true", "linguist-vendored", "linguist-vendored=true":
+				include = false
+			case "-linguist-generated", "linguist-generated=false", "-linguist-vendored", "linguist-vendored=false":
+				include = true
+			default:
+				continue
+			}
+
+			// Invalid patterns are skipped like git does.
+			ret.add(dir, fields[0], include, true)
+		}
+	}
+
+	return ret
+}
+
+// compile translates a gitignore pattern relative to the directory base into
+// a regular expression matching whole paths.
+func compile(base string, pattern string) (rule, error) {
+	var r rule
+
+	if strings.HasSuffix(pattern, "/") {
+		r.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+
+	// A pattern with a slash anywhere but the end is relative to the root,
+	// otherwise it matches a name at any depth.
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	if base != "" {
+		r.prefix = base + "/"
+	}
+	if anchored {
+		literal := pattern
+		if i := strings.IndexAny(literal, "*?[\\"); i >= 0 {
+			literal = literal[:i]
+		}
+		r.prefix += literal
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	if base != "" {
+		b.WriteString(regexp.QuoteMeta(base + "/"))
+	}
+	if !anchored {
+		b.WriteString("(?:.*/)?")
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**") && i+2 == len(pattern):
+			b.WriteString(".*")
+			i += 1
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+
+	b.WriteString("$")
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return rule{}, err
+	}
+
+	r.re = re
+	return r, nil
+}
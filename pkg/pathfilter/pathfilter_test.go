@@ -0,0 +1,89 @@
+package pathfilter
+
+import "testing"
+
+func TestWithAttributesNested(t *testing.T) {
+	f, err := New(Defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f = f.WithAttributes("", "*.gen.ts linguist-generated\n")
+	f = f.WithAttributes("packages/a", "generated/** linguist-generated\n/src/keep.gen.ts -linguist-generated\nthird_party/** linguist-vendored\n")
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"src/index.ts", false},
+		{"src/api.gen.ts", true},
+		{"packages/a/generated/types.ts", true},
+		{"packages/a/src/generated/types.ts", false},
+		{"packages/b/generated/types.ts", false},
+		{"packages/a/src/keep.gen.ts", false},
+		{"packages/a/lib/src/keep.gen.ts", true},
+		{"packages/a/third_party/x/y.ts", true},
+		{"third_party/x/y.ts", false},
+	}
+
+	for _, tt := range tests {
+		if got := f.Excluded(tt.path, false); got != tt.want {
+			t.Errorf("Excluded(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+// TestWithAttributesDirectory checks attribute patterns only match files
+// like git's, a directory pattern matches nothing.
+func TestWithAttributesDirectory(t *testing.T) {
+	f, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f = f.WithAttributes("", "generated/ linguist-generated\nsrc linguist-vendored\n")
+
+	for _, path := range []string{"generated/types.ts", "packages/a/generated/types.ts", "src/index.ts", "generated"} {
+		if f.Excluded(path, false) {
+			t.Errorf("Excluded(%q) = true, want false", path)
+		}
+	}
+
+	if f.Prune("src") {
+		t.Errorf("Prune(src) = true, want false")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	f, err := New(append(Defaults, "!node_modules/@types/**"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"node_modules", false},
+		{"node_modules/@types", false},
+		{"node_modules/react", true},
+		{"packages/a/node_modules", true},
+		{"dist", true},
+		{"src", false},
+	}
+
+	for _, tt := range tests {
+		if got := f.Prune(tt.path); got != tt.want {
+			t.Errorf("Prune(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	// An include rule that can match at any depth stops every prune.
+	f, err = New(append(Defaults, "!*.ts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Prune("node_modules/react") {
+		t.Errorf("Prune(node_modules/react) = true with an unanchored include rule")
+	}
+}
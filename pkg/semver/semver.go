@@ -0,0 +1,405 @@
+package semver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version. Build metadata is dropped.
+type Version struct {
+	Major, Minor, Patch int
+	Prerelease          string
+}
+
+// Parse parses a full version such as 4.9.4 or v5.0.0-beta.
+func Parse(s string) (Version, error) {
+	v, parts, err := parsePartial(s)
+	if err != nil {
+		return Version{}, err
+	}
+	if parts < 3 {
+		return Version{}, fmt.Errorf("incomplete version %q", s)
+	}
+	return v, nil
+}
+
+func (v Version) String() string {
+	ret := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		ret += "-" + v.Prerelease
+	}
+	return ret
+}
+
+// Compare returns -1, 0 or 1 as v is lower than, equal to or higher than
+// other. Prerelease identifiers are compared as a whole, numerically when
+// both are numbers.
+func (v Version) Compare(other Version) int {
+	for _, d := range []int{v.Major - other.Major, v.Minor - other.Minor, v.Patch - other.Patch} {
+		if d < 0 {
+			return -1
+		} else if d > 0 {
+			return 1
+		}
+	}
+
+	switch {
+	case v.Prerelease == other.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case other.Prerelease == "":
+		return -1
+	}
+
+	a, b := strings.Split(v.Prerelease, "."), strings.Split(other.Prerelease, ".")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] == b[i] {
+			continue
+		}
+
+		an, aErr := strconv.Atoi(a[i])
+		bn, bErr := strconv.Atoi(b[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an < bn {
+				return -1
+			}
+			return 1
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		case a[i] < b[i]:
+			return -1
+		default:
+			return 1
+		}
+	}
+
+	if len(a) < len(b) {
+		return -1
+	} else if len(a) > len(b) {
+		return 1
+	}
+	return 0
+}
+
+// parsePartial parses a version that may leave out the minor and patch
+// numbers or use x or * for them. It returns how many numbers were given.
+func parsePartial(s string) (Version, int, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "=")
+	s = strings.TrimPrefix(s, "v")
+
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+
+	var v Version
+
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		v.Prerelease = s[i+1:]
+		s = s[:i]
+	}
+
+	if s == "" {
+		return Version{}, 0, fmt.Errorf("empty version")
+	}
+
+	fields := strings.Split(s, ".")
+	if len(fields) > 3 {
+		return Version{}, 0, fmt.Errorf("invalid version %q", s)
+	}
+
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	parts := 0
+
+	for i, field := range fields {
+		if field == "x" || field == "X" || field == "*" {
+			break
+		}
+
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return Version{}, 0, fmt.Errorf("invalid version %q", s)
+		}
+
+		*nums[i] = n
+		parts++
+	}
+
+	if parts < 3 {
+		// A prerelease only means something on a full version.
+		v.Prerelease = ""
+	}
+
+	return v, parts, nil
+}
+
+type comparator struct {
+	op string
+	v  Version
+}
+
+func (c comparator) matches(v Version) bool {
+	cmp := v.Compare(c.v)
+	switch c.op {
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	default:
+		return cmp == 0
+	}
+}
+
+// Range is a set of versions in the syntax npm uses for dependencies, a list
+// of comparator sets joined by ||.
+type Range struct {
+	raw  string
+	sets [][]comparator
+}
+
+// ParseRange parses an npm version range. Dist tags such as latest, file and
+// git dependencies and the workspace: protocol aren't ranges and return an
+// error. npm: aliases are parsed as the aliased package's range.
+func ParseRange(s string) (Range, error) {
+	raw := s
+	s = strings.TrimSpace(s)
+
+	if strings.HasPrefix(s, "npm:") {
+		s = s[len("npm:"):]
+		if i := strings.LastIndexByte(s, '@'); i > 0 {
+			s = s[i+1:]
+		}
+	}
+
+	r := Range{raw: raw}
+
+	for _, part := range strings.Split(s, "||") {
+		set, err := parseSet(strings.TrimSpace(part))
+		if err != nil {
+			return Range{}, fmt.Errorf("invalid range %q: %v", raw, err)
+		}
+		r.sets = append(r.sets, set)
+	}
+
+	return r, nil
+}
+
+func (r Range) String() string {
+	return r.raw
+}
+
+// Contains reports whether v is in the range. Like npm a prerelease is only
+// in the range if a comparator mentions a prerelease of the same version.
+func (r Range) Contains(v Version) bool {
+sets:
+	for _, set := range r.sets {
+		allowPrerelease := v.Prerelease == ""
+
+		for _, c := range set {
+			if !c.matches(v) {
+				continue sets
+			}
+			if c.v.Prerelease != "" && c.v.Major == v.Major && c.v.Minor == v.Minor && c.v.Patch == v.Patch {
+				allowPrerelease = true
+			}
+		}
+
+		if allowPrerelease {
+			return true
+		}
+	}
+	return false
+}
+
+// Min returns the lowest version in the range. ok is false if nothing can
+// satisfy it or it has no lower bound, like * or <5.
+func (r Range) Min() (min Version, ok bool) {
+	for _, set := range r.sets {
+		v := Version{}
+		bounded := false
+		for _, c := range set {
+			switch c.op {
+			case ">=", "=":
+				bounded = true
+				if c.v.Compare(v) > 0 {
+					v = c.v
+				}
+			case ">":
+				bounded = true
+				next := c.v
+				if next.Prerelease != "" {
+					next.Prerelease += ".0"
+				} else {
+					next.Patch++
+				}
+				if next.Compare(v) > 0 {
+					v = next
+				}
+			}
+		}
+
+		if !setContains(set, v) {
+			continue
+		}
+
+		if !bounded {
+			return Version{}, false
+		}
+
+		if !ok || v.Compare(min) < 0 {
+			min, ok = v, true
+		}
+	}
+
+	return min, ok
+}
+
+func setContains(set []comparator, v Version) bool {
+	for _, c := range set {
+		if !c.matches(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseSet(s string) ([]comparator, error) {
+	// Any version, an empty set has nothing to fail.
+	if s == "" || s == "*" || s == "x" || s == "X" {
+		return nil, nil
+	}
+
+	fields := strings.Fields(s)
+
+	// Hyphen ranges, 1.2.3 - 2.3.4.
+	if len(fields) == 3 && fields[1] == "-" {
+		lo, _, err := parsePartial(fields[0])
+		if err != nil {
+			return nil, err
+		}
+
+		hi, parts, err := parsePartial(fields[2])
+		if err != nil {
+			return nil, err
+		}
+
+		ret := []comparator{{op: ">=", v: lo}}
+		if parts == 3 {
+			return append(ret, comparator{op: "<=", v: hi}), nil
+		}
+		return append(ret, comparator{op: "<", v: bump(hi, parts)}), nil
+	}
+
+	// Operators may be separated from their version by spaces.
+	var joined []string
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		if strings.Trim(f, "<>=~^") == "" && i+1 < len(fields) {
+			f += fields[i+1]
+			i++
+		}
+		joined = append(joined, f)
+	}
+
+	var ret []comparator
+	for _, f := range joined {
+		cs, err := parseComparator(f)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, cs...)
+	}
+
+	return ret, nil
+}
+
+// parseComparator expands a single comparator, possibly a tilde, caret or
+// partial version, into plain comparators.
+func parseComparator(s string) ([]comparator, error) {
+	op := ""
+	for _, prefix := range []string{">=", "<=", ">", "<", "=", "~>", "~", "^"} {
+		if strings.HasPrefix(s, prefix) {
+			op = prefix
+			s = s[len(prefix):]
+			break
+		}
+	}
+
+	v, parts, err := parsePartial(s)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "~", "~>":
+		// ~1.2.3 and ~1.2 allow patches, ~1 allows minors.
+		if parts == 0 {
+			return nil, nil
+		}
+		upper := 2
+		if parts < 2 {
+			upper = 1
+		}
+		return []comparator{{">=", v}, {"<", bump(v, upper)}}, nil
+	case "^":
+		// ^ allows changes that don't modify the left-most non-zero
+		// number, counting only the numbers given.
+		if parts == 0 {
+			return nil, nil
+		}
+		upper := 1
+		switch {
+		case v.Major == 0 && v.Minor == 0 && parts == 3:
+			upper = 3
+		case v.Major == 0 && parts >= 2:
+			upper = 2
+		}
+		return []comparator{{">=", v}, {"<", bump(v, upper)}}, nil
+	case ">":
+		if parts < 3 {
+			return []comparator{{">=", bump(v, parts)}}, nil
+		}
+		return []comparator{{">", v}}, nil
+	case "<=":
+		if parts < 3 {
+			return []comparator{{"<", bump(v, parts)}}, nil
+		}
+		return []comparator{{"<=", v}}, nil
+	case ">=", "<":
+		return []comparator{{op, v}}, nil
+	default:
+		// A partial version is a range, 1.2 means >=1.2.0 <1.3.0.
+		if parts == 0 {
+			return nil, nil
+		}
+		if parts < 3 {
+			return []comparator{{">=", v}, {"<", bump(v, parts)}}, nil
+		}
+		return []comparator{{"=", v}}, nil
+	}
+}
+
+// bump returns the lowest version after every version starting with the
+// first n numbers of v.
+func bump(v Version, n int) Version {
+	switch n {
+	case 1:
+		return Version{Major: v.Major + 1}
+	case 2:
+		return Version{Major: v.Major, Minor: v.Minor + 1}
+	case 3:
+		return Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1}
+	default:
+		// Nothing given, there is no upper bound. Callers avoid this.
+		return Version{Major: int(^uint(0) >> 1)}
+	}
+}
@@ -0,0 +1,78 @@
+package semver
+
+import "testing"
+
+func TestRangeMin(t *testing.T) {
+	tests := []struct {
+		rng  string
+		want string
+		ok   bool
+	}{
+		{rng: "^4.9.4", want: "4.9.4", ok: true},
+		{rng: "~4.1", want: "4.1.0", ok: true},
+		{rng: "4.x", want: "4.0.0", ok: true},
+		{rng: ">4.1", want: "4.2.0", ok: true},
+		{rng: ">=4.0.0 <5", want: "4.0.0", ok: true},
+		{rng: "3.9.7 - 4.1", want: "3.9.7", ok: true},
+		{rng: "^4.5 || ^3.8", want: "3.8.0", ok: true},
+		{rng: "npm:typescript@^5.0.0", want: "5.0.0", ok: true},
+		{rng: "5.0.0-beta", want: "5.0.0-beta", ok: true},
+
+		// No lower bound.
+		{rng: "*"},
+		{rng: "x"},
+		{rng: ""},
+		{rng: "<5"},
+		{rng: "<=4.9.4"},
+		{rng: "^4.5 || *"},
+
+		// Nothing satisfies it.
+		{rng: ">5 <4"},
+	}
+
+	for _, tt := range tests {
+		r, err := ParseRange(tt.rng)
+		if err != nil {
+			t.Errorf("ParseRange(%q) error = %v", tt.rng, err)
+			continue
+		}
+
+		min, ok := r.Min()
+		if ok != tt.ok || (ok && min.String() != tt.want) {
+			t.Errorf("ParseRange(%q).Min() = %v, %v, want %v, %v", tt.rng, min, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRangeContains(t *testing.T) {
+	tests := []struct {
+		rng     string
+		version string
+		want    bool
+	}{
+		{"*", "4.9.4", true},
+		{"*", "5.0.0-beta", false},
+		{"", "1.0.0", true},
+		{"<5", "4.9.4", true},
+		{"<5", "5.0.0", false},
+		{"^4.9.4", "4.9.5", true},
+		{"^4.9.4", "5.0.0", false},
+	}
+
+	for _, tt := range tests {
+		r, err := ParseRange(tt.rng)
+		if err != nil {
+			t.Errorf("ParseRange(%q) error = %v", tt.rng, err)
+			continue
+		}
+
+		v, err := Parse(tt.version)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", tt.version, err)
+		}
+
+		if got := r.Contains(v); got != tt.want {
+			t.Errorf("ParseRange(%q).Contains(%s) = %v, want %v", tt.rng, tt.version, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package tsbridge
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"example.com/jsdata/v3/pkg/metrics"
+)
+
+var (
+	detectorKind = flag.String("detector", "backend", "How features are detected: backend uses the TypeScript backend, native uses the built in Go tokenizer for lexical features only, crosscheck uses the backend and reports files where the native detector disagrees.")
+)
+
+var (
+	crossCheckFiles         = metrics.NewCounter("tsbridge_crosscheck_files_total", "Files analysed by both detectors in crosscheck mode.")
+	crossCheckDisagreements = metrics.NewCounter("tsbridge_crosscheck_disagreements_total", "Features counted differently by the two detectors in crosscheck mode.")
+)
+
+// Detector reports the TypeScript features used in files. A Bridge to the
+// TypeScript backend is one implementation and NativeDetector another.
+type Detector interface {
+	CallContext(ctx context.Context, req Request) (Response, error)
+	CallBatchContext(ctx context.Context, reqs []Request) ([]Response, error)
+	Version(ctx context.Context) (VersionInfo, error)
+	Close() error
+}
+
+var (
+	_ Detector = (*Bridge)(nil)
+	_ Detector = (*NativeDetector)(nil)
+	_ Detector = (*CrossCheck)(nil)
+)
+
+// CrossCheck answers with Primary's results and also runs every file through
+// Secondary, logging each feature Secondary supports but counts differently.
+type CrossCheck struct {
+	Primary   Detector
+	Secondary Detector
+
+	compared []string
+}
+
+// NewCrossCheck creates a CrossCheck comparing the features secondary
+// reports in its version handshake.
+func NewCrossCheck(ctx context.Context, primary Detector, secondary Detector) (*CrossCheck, error) {
+	v, err := secondary.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CrossCheck{Primary: primary, Secondary: secondary, compared: v.Detectors}, nil
+}
+
+func (c *CrossCheck) compare(filename string, primary Response, secondary Response) {
+	// Files either detector failed on have nothing to compare.
+	if primary.Error != "" || secondary.Error != "" {
+		return
+	}
+
+	crossCheckFiles.Inc()
+
+	for _, name := range c.compared {
+		a, b := primary.Count(name), secondary.Count(name)
+		if a != b {
+			crossCheckDisagreements.Inc()
+			log.Printf("crosscheck: %s: %s counted %d by the primary and %d by the secondary detector", filename, name, a, b)
+		}
+	}
+}
+
+// CallContext implements Detector
+func (c *CrossCheck) CallContext(ctx context.Context, req Request) (Response, error) {
+	resp, err := c.Primary.CallContext(ctx, req)
+	if err != nil {
+		return Response{}, err
+	}
+
+	other, err := c.Secondary.CallContext(ctx, req)
+	if err != nil {
+		log.Printf("crosscheck: %s: secondary detector failed: %v", req.Filename, err)
+		return resp, nil
+	}
+
+	c.compare(req.Filename, resp, other)
+
+	return resp, nil
+}
+
+// CallBatchContext implements Detector
+func (c *CrossCheck) CallBatchContext(ctx context.Context, reqs []Request) ([]Response, error) {
+	resps, err := c.Primary.CallBatchContext(ctx, reqs)
+	if err != nil {
+		return nil, err
+	}
+
+	others, err := c.Secondary.CallBatchContext(ctx, reqs)
+	if err != nil {
+		log.Printf("crosscheck: batch of %d: secondary detector failed: %v", len(reqs), err)
+		return resps, nil
+	}
+
+	for i, req := range reqs {
+		c.compare(req.Filename, resps[i], others[i])
+	}
+
+	return resps, nil
+}
+
+// Version implements Detector
+func (c *CrossCheck) Version(ctx context.Context) (VersionInfo, error) {
+	return c.Primary.Version(ctx)
+}
+
+// Close implements Detector
+func (c *CrossCheck) Close() error {
+	c.Secondary.Close()
+	return c.Primary.Close()
+}
+
+// StartDetector returns the detector chosen by the -detector flag, starting
+// a bridge with StartBridge when the backend is needed.
+func StartDetector(ctx context.Context) (Detector, error) {
+	switch *detectorKind {
+	case "backend":
+		return StartBridge(ctx)
+	case "native":
+		return NewNativeDetector(), nil
+	case "crosscheck":
+		bridge, err := StartBridge(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		c, err := NewCrossCheck(ctx, bridge, NewNativeDetector())
+		if err != nil {
+			bridge.Close()
+			return nil, err
+		}
+
+		return c, nil
+	default:
+		return nil, fmt.Errorf("unknown detector %q", *detectorKind)
+	}
+}
@@ -0,0 +1,71 @@
+package tsbridge
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// ErrParseFailed means the backend could not process the file. Retrying
+	// the same request gives the same result.
+	ErrParseFailed = errors.New("backend failed to process file")
+	// ErrServerUnavailable means the backend could not be reached, or kept
+	// failing, for every attempt.
+	ErrServerUnavailable = errors.New("backend unavailable")
+	// ErrTimeout means the final attempt exceeded the request timeout.
+	ErrTimeout = errors.New("backend request timed out")
+	// ErrUnsupported means the backend doesn't implement the endpoint, usually
+	// because it is an older version.
+	ErrUnsupported = errors.New("backend does not support the request")
+)
+
+// ServerError is a non-200 response from the backend along with the error
+// message from its payload.
+type ServerError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *ServerError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("backend returned %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("backend returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Is maps the status code to ErrParseFailed, ErrServerUnavailable or
+// ErrUnsupported.
+func (e *ServerError) Is(target error) bool {
+	switch target {
+	case ErrParseFailed:
+		return !e.Temporary() && !e.unsupported()
+	case ErrServerUnavailable:
+		return e.Temporary()
+	case ErrUnsupported:
+		return e.unsupported()
+	default:
+		return false
+	}
+}
+
+func (e *ServerError) unsupported() bool {
+	switch e.StatusCode {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	default:
+		return false
+	}
+}
+
+// Temporary reports whether the request is worth retrying. The backend
+// answers 500 when processing the file throws, which is deterministic, while
+// 502, 503 and 504 come from overload or a backend that is restarting.
+func (e *ServerError) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout, http.StatusTooManyRequests:
+		return true
+	default:
+		return false
+	}
+}
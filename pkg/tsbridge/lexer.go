@@ -0,0 +1,456 @@
+package tsbridge
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokIdent tokenKind = iota
+	tokPrivateName
+	tokNumber
+	tokString
+	tokTemplate
+	tokRegexp
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// pos is the byte offset of the token in the source.
+	pos int
+	// nl is set when a line break separates the token from the previous one.
+	nl bool
+	// inClass is set for tokens directly inside a class body, not nested in
+	// a method body or initialiser.
+	inClass bool
+}
+
+// punctuators are matched longest first.
+var punctuators = []string{
+	">>>=",
+	"...", "===", "!==", "**=", "<<=", ">>=", ">>>", "&&=", "||=", "??=",
+	"=>", "==", "!=", "<=", ">=", "&&", "||", "??", "?.", "++", "--",
+	"+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "**", "<<", ">>",
+}
+
+// regexpAfter are the keywords after which a slash starts a regular
+// expression rather than a division.
+var regexpAfter = map[string]bool{
+	"return": true, "typeof": true, "case": true, "do": true, "else": true,
+	"in": true, "of": true, "new": true, "delete": true, "void": true,
+	"throw": true, "instanceof": true, "yield": true, "await": true,
+}
+
+// conditionKeywords are followed by a parenthesised condition, after which
+// a slash starts a regular expression.
+var conditionKeywords = map[string]bool{
+	"if": true, "while": true, "for": true, "with": true,
+}
+
+type braceKind int
+
+const (
+	braceBlock braceKind = iota
+	braceClass
+	braceTemplate
+)
+
+// lexer splits TypeScript source into tokens. It only understands enough of
+// the language to skip comments, strings, templates and regular expressions
+// and to know when it is inside a class body, it never fails on invalid
+// input.
+type lexer struct {
+	src string
+	pos int
+
+	tokens []token
+	nl     bool
+
+	braces []braceKind
+	parens int
+
+	// conditions holds the paren depth of each open if, while, for or with
+	// condition, and conditionEnd is set right after one closes, where a
+	// slash starts a regular expression.
+	conditions   []int
+	conditionEnd bool
+
+	// classes holds the class headers seen but whose body hasn't opened
+	// yet, innermost last. An extends expression can hold a class of its
+	// own.
+	classes []classHeader
+}
+
+// classHeader tracks nesting between the class keyword and the brace
+// opening its body so braces in type arguments or an extends expression
+// aren't mistaken for the body.
+type classHeader struct {
+	parens int
+	angles int
+}
+
+func tokenize(src string) []token {
+	l := &lexer{src: src}
+	l.run()
+	return l.tokens
+}
+
+func (l *lexer) emit(kind tokenKind, start int) {
+	l.tokens = append(l.tokens, token{
+		kind:    kind,
+		text:    l.src[start:l.pos],
+		pos:     start,
+		nl:      l.nl,
+		inClass: len(l.braces) > 0 && l.braces[len(l.braces)-1] == braceClass,
+	})
+	l.nl = false
+	l.conditionEnd = false
+}
+
+func (l *lexer) last() *token {
+	if len(l.tokens) == 0 {
+		return nil
+	}
+	return &l.tokens[len(l.tokens)-1]
+}
+
+func (l *lexer) regexpAllowed() bool {
+	t := l.last()
+	if t == nil || l.conditionEnd {
+		return true
+	}
+
+	switch t.kind {
+	case tokIdent:
+		return regexpAfter[t.text]
+	case tokPunct:
+		return t.text != ")" && t.text != "]" && t.text != "}"
+	default:
+		return false
+	}
+}
+
+func isIdentStart(r rune) bool {
+	return r == '$' || r == '_' || r == '\\' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return isIdentStart(r) || unicode.IsDigit(r) || r == '\u200c' || r == '\u200d'
+}
+
+func (l *lexer) run() {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+
+		switch {
+		case c == '\n':
+			l.nl = true
+			l.pos++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			l.pos++
+		case strings.HasPrefix(l.src[l.pos:], "//"):
+			l.skipLineComment()
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			l.skipBlockComment()
+		case c == '\'' || c == '"':
+			l.lexString(c)
+		case c == '`':
+			start := l.pos
+			l.pos++
+			l.lexTemplate(start)
+		case c == '#':
+			start := l.pos
+			l.pos++
+			l.skipIdent()
+			l.emit(tokPrivateName, start)
+		case c >= '0' && c <= '9' || c == '.' && l.pos+1 < len(l.src) && l.src[l.pos+1] >= '0' && l.src[l.pos+1] <= '9':
+			l.lexNumber()
+		case c == '/' && l.regexpAllowed():
+			l.lexRegexp()
+		default:
+			r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+			if isIdentStart(r) {
+				start := l.pos
+				l.skipIdent()
+				l.emit(tokIdent, start)
+				l.afterIdent()
+			} else if unicode.IsSpace(r) {
+				if r == '\u2028' || r == '\u2029' {
+					l.nl = true
+				}
+				l.pos += size
+			} else {
+				l.lexPunct()
+			}
+		}
+	}
+}
+
+func (l *lexer) skipLineComment() {
+	end := strings.IndexByte(l.src[l.pos:], '\n')
+	if end < 0 {
+		l.pos = len(l.src)
+		return
+	}
+	l.pos += end
+}
+
+func (l *lexer) skipBlockComment() {
+	end := strings.Index(l.src[l.pos+2:], "*/")
+	if end < 0 {
+		l.pos = len(l.src)
+		return
+	}
+	if strings.IndexByte(l.src[l.pos:l.pos+2+end], '\n') >= 0 {
+		l.nl = true
+	}
+	l.pos += 2 + end + 2
+}
+
+func (l *lexer) skipIdent() {
+	for l.pos < len(l.src) {
+		r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+		if !isIdentPart(r) {
+			return
+		}
+		if r == '\\' {
+			l.skipEscape()
+			continue
+		}
+		l.pos += size
+	}
+	if l.pos > len(l.src) {
+		l.pos = len(l.src)
+	}
+}
+
+// skipEscape skips a unicode escape in an identifier, \uXXXX or \u{...}.
+func (l *lexer) skipEscape() {
+	rest := l.src[l.pos:]
+	switch {
+	case strings.HasPrefix(rest, "\\u{"):
+		end := strings.IndexByte(rest, '}')
+		if end < 0 {
+			l.pos = len(l.src)
+			return
+		}
+		l.pos += end + 1
+	case strings.HasPrefix(rest, "\\u"):
+		l.pos += 6
+	default:
+		l.pos += 2
+	}
+	if l.pos > len(l.src) {
+		l.pos = len(l.src)
+	}
+}
+
+func (l *lexer) lexString(quote byte) {
+	start := l.pos
+	l.pos++
+
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if c == '\\' {
+			l.pos += 2
+			continue
+		}
+		l.pos++
+		if c == quote || c == '\n' {
+			break
+		}
+	}
+
+	if l.pos > len(l.src) {
+		l.pos = len(l.src)
+	}
+
+	l.emit(tokString, start)
+}
+
+// lexTemplate scans template text up to the closing backtick or the start
+// of a substitution. A substitution pushes a brace so the matching } resumes
+// the template.
+func (l *lexer) lexTemplate(start int) {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\\':
+			l.pos += 2
+			continue
+		case c == '`':
+			l.pos++
+			l.emit(tokTemplate, start)
+			return
+		case c == '$' && l.pos+1 < len(l.src) && l.src[l.pos+1] == '{':
+			l.pos += 2
+			l.emit(tokTemplate, start)
+			l.braces = append(l.braces, braceTemplate)
+			return
+		}
+		l.pos++
+	}
+
+	l.pos = len(l.src)
+	l.emit(tokTemplate, start)
+}
+
+func (l *lexer) lexNumber() {
+	start := l.pos
+
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c >= '0' && c <= '9', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == '.':
+			l.pos++
+		case (c == '+' || c == '-') && (l.src[l.pos-1] == 'e' || l.src[l.pos-1] == 'E') && !strings.HasPrefix(strings.ToLower(l.src[start:]), "0x"):
+			l.pos++
+		default:
+			l.emit(tokNumber, start)
+			return
+		}
+	}
+
+	l.emit(tokNumber, start)
+}
+
+func (l *lexer) lexRegexp() {
+	start := l.pos
+	l.pos++
+
+	inClass := false
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if c == '\\' {
+			l.pos += 2
+			continue
+		}
+		if c == '\n' {
+			break
+		}
+		l.pos++
+		if c == '[' {
+			inClass = true
+		} else if c == ']' {
+			inClass = false
+		} else if c == '/' && !inClass {
+			break
+		}
+	}
+
+	if l.pos > len(l.src) {
+		l.pos = len(l.src)
+	}
+
+	// Flags.
+	for l.pos < len(l.src) {
+		r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+		if !isIdentPart(r) {
+			break
+		}
+		l.pos += size
+	}
+
+	l.emit(tokRegexp, start)
+}
+
+func (l *lexer) lexPunct() {
+	start := l.pos
+
+	text := ""
+	for _, p := range punctuators {
+		if strings.HasPrefix(l.src[l.pos:], p) {
+			text = p
+			break
+		}
+	}
+	if text == "" {
+		_, size := utf8.DecodeRuneInString(l.src[l.pos:])
+		text = l.src[l.pos : l.pos+size]
+	}
+
+	// ?. followed by a digit is a conditional followed by a number.
+	if text == "?." && l.pos+2 < len(l.src) && l.src[l.pos+2] >= '0' && l.src[l.pos+2] <= '9' {
+		text = "?"
+	}
+
+	var class *classHeader
+	if n := len(l.classes); n > 0 {
+		class = &l.classes[n-1]
+	}
+
+	switch text {
+	case "(":
+		if t := l.last(); t != nil && t.kind == tokIdent && conditionKeywords[t.text] {
+			l.conditions = append(l.conditions, l.parens)
+		}
+		l.parens++
+	case ")":
+		l.parens--
+		if n := len(l.conditions); n > 0 && l.conditions[n-1] == l.parens {
+			l.conditions = l.conditions[:n-1]
+			l.pos += len(text)
+			l.emit(tokPunct, start)
+			l.conditionEnd = true
+			return
+		}
+	case "<":
+		if class != nil {
+			class.angles++
+		}
+	case ">":
+		if class != nil && class.angles > 0 {
+			class.angles--
+		}
+	case "{":
+		kind := braceBlock
+		if class != nil && l.parens == class.parens && class.angles == 0 {
+			kind = braceClass
+			l.classes = l.classes[:len(l.classes)-1]
+		}
+		l.pos += len(text)
+		l.emit(tokPunct, start)
+		l.braces = append(l.braces, kind)
+		return
+	case "}":
+		if n := len(l.braces); n > 0 {
+			kind := l.braces[n-1]
+			l.braces = l.braces[:n-1]
+			if kind == braceTemplate {
+				l.pos++
+				l.lexTemplate(start)
+				return
+			}
+		}
+		l.pos += len(text)
+		l.emit(tokPunct, start)
+		return
+	}
+
+	l.pos += len(text)
+	l.emit(tokPunct, start)
+}
+
+// afterIdent notices the start of a class so its body can be recognised.
+func (l *lexer) afterIdent() {
+	n := len(l.tokens)
+	if l.tokens[n-1].text != "class" {
+		return
+	}
+	if n > 1 && l.tokens[n-2].kind == tokPunct && (l.tokens[n-2].text == "." || l.tokens[n-2].text == "?.") {
+		return
+	}
+
+	// class used as a property name or binding rather than a declaration.
+	rest := strings.TrimLeft(l.src[l.pos:], " \t\r\n")
+	if rest != "" && strings.IndexByte(":,)=;?", rest[0]) >= 0 {
+		return
+	}
+
+	l.classes = append(l.classes, classHeader{parens: l.parens})
+}
@@ -0,0 +1,321 @@
+package tsbridge
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// nativeDetectorVersion plays the part of DETECTOR_VERSION in src/index.ts
+// for NativeDetector, bump it whenever a native detector changes.
+const nativeDetectorVersion = 3
+
+// nativeDetectors are the features NativeDetector can find from tokens
+// alone.
+var nativeDetectors = []string{
+	"AccessorKeyword",
+	"SatisfiesExpression",
+	"StaticBlockInClass",
+	"OverrideOnClassMethod",
+	"ShortCircuitAssignment",
+}
+
+// classModifiers may come before the name of a class member.
+var classModifiers = map[string]bool{
+	"static": true, "public": true, "private": true, "protected": true,
+	"readonly": true, "async": true, "abstract": true, "declare": true,
+	"override": true, "accessor": true,
+}
+
+// notExpressionEnd are keywords that can't be the last token of an
+// expression, so satisfies after them is an identifier.
+var notExpressionEnd = map[string]bool{
+	"const": true, "let": true, "var": true, "function": true, "class": true,
+	"export": true, "import": true, "interface": true, "enum": true,
+	"extends": true, "implements": true, "if": true, "while": true, "for": true,
+	"switch": true, "catch": true, "with": true, "as": true, "satisfies": true,
+	"namespace": true, "module": true, "keyof": true, "is": true, "infer": true,
+}
+
+// NativeDetector finds the purely lexical features without a backend by
+// tokenizing files in Go. Features that need a parse tree are never
+// reported, see nativeDetectors for the ones it knows.
+type NativeDetector struct{}
+
+func NewNativeDetector() *NativeDetector {
+	return &NativeDetector{}
+}
+
+// CallContext implements Detector
+func (d *NativeDetector) CallContext(ctx context.Context, req Request) (Response, error) {
+	start := time.Now()
+
+	counts, first, matches := detectNative(req.FileContents, req.Matches)
+
+	features := make(map[string]bool, len(counts))
+	for name := range counts {
+		features[name] = true
+	}
+
+	return Response{
+		Version:     ProtocolVersion,
+		ProcessTime: uint64(time.Since(start).Nanoseconds()),
+		Features:    features,
+		Counts:      counts,
+		First:       first,
+		Matches:     matches,
+	}, nil
+}
+
+// CallBatchContext implements Detector
+func (d *NativeDetector) CallBatchContext(ctx context.Context, reqs []Request) ([]Response, error) {
+	ret := make([]Response, len(reqs))
+
+	for i, req := range reqs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		ret[i], _ = d.CallContext(ctx, req)
+	}
+
+	return ret, nil
+}
+
+// Version implements Detector
+func (d *NativeDetector) Version(ctx context.Context) (VersionInfo, error) {
+	return VersionInfo{
+		Protocol:        ProtocolVersion,
+		DetectorVersion: nativeDetectorVersion,
+		Detectors:       nativeDetectors,
+		Native:          true,
+	}, nil
+}
+
+// Close implements Detector
+func (d *NativeDetector) Close() error {
+	return nil
+}
+
+// detectNative returns the number of times each feature appears in src,
+// where each first appears and, if withMatches is set, every match.
+// Positions are those of the token that gives the feature away, such as the
+// operator of a short circuit assignment, where the backend reports the
+// start of the whole node.
+func detectNative(src string, withMatches bool) (map[string]int, map[string]Position, []Match) {
+	toks := tokenize(src)
+	counts := make(map[string]int)
+	first := make(map[string]Position)
+	var matches []Match
+
+	found := func(name string, t token) {
+		counts[name] += 1
+		if _, ok := first[name]; !ok {
+			first[name] = position(src, t.pos)
+		}
+		if withMatches {
+			p := position(src, t.pos)
+			matches = append(matches, Match{Feature: name, Line: p.Line, Column: p.Column, Snippet: snippet(src, t.pos)})
+		}
+	}
+
+	for i, t := range toks {
+		switch t.kind {
+		case tokPunct:
+			if t.text == "??=" || t.text == "||=" || t.text == "&&=" {
+				found("ShortCircuitAssignment", t)
+			}
+		case tokIdent:
+			switch t.text {
+			case "satisfies":
+				if isSatisfies(toks, i) {
+					found("SatisfiesExpression", t)
+				}
+			case "accessor":
+				if isModifier(toks, i) && !isMethod(toks, i+1) {
+					found("AccessorKeyword", t)
+				}
+			case "override":
+				if isModifier(toks, i) && isMethod(toks, i+1) {
+					found("OverrideOnClassMethod", t)
+				}
+			case "static":
+				if t.inClass && i+1 < len(toks) && toks[i+1].text == "{" {
+					found("StaticBlockInClass", t)
+				}
+			}
+		}
+	}
+
+	return counts, first, matches
+}
+
+// position converts a byte offset in src to a line and UTF-16 column,
+// treating line breaks the way TypeScript does.
+func position(src string, offset int) Position {
+	p := Position{Line: 1, Column: 1}
+
+	for i, r := range src {
+		if i >= offset {
+			break
+		}
+
+		switch {
+		case r == '\r' && i+1 < len(src) && src[i+1] == '\n':
+			// The \n ends the line.
+		case r == '\n', r == '\r', r == '\u2028', r == '\u2029':
+			p.Line++
+			p.Column = 1
+		case r >= 0x10000:
+			p.Column += 2
+		default:
+			p.Column++
+		}
+	}
+
+	return p
+}
+
+func isLineBreak(r rune) bool {
+	return r == '\n' || r == '\r' || r == '\u2028' || r == '\u2029'
+}
+
+// snippet returns the line containing the byte offset in src, cut to
+// SnippetLength UTF-16 code units.
+func snippet(src string, offset int) string {
+	start := 0
+	if i := strings.LastIndexFunc(src[:offset], isLineBreak); i >= 0 {
+		_, size := utf8.DecodeRuneInString(src[i:])
+		start = i + size
+	}
+
+	line := src[start:]
+	if end := strings.IndexFunc(line, isLineBreak); end >= 0 {
+		line = line[:end]
+	}
+
+	units := 0
+	for i, r := range line {
+		units++
+		if r >= 0x10000 {
+			units++
+		}
+		if units > SnippetLength {
+			return line[:i]
+		}
+	}
+
+	return line
+}
+
+// isSatisfies reports whether the satisfies at i is the operator: it
+// follows an expression on the same line and is followed by a type.
+func isSatisfies(toks []token, i int) bool {
+	if i == 0 || i+1 >= len(toks) || toks[i].nl {
+		return false
+	}
+
+	prev, next := toks[i-1], toks[i+1]
+
+	switch prev.kind {
+	case tokIdent:
+		if notExpressionEnd[prev.text] || regexpAfter[prev.text] {
+			return false
+		}
+	case tokTemplate:
+		if !strings.HasSuffix(prev.text, "`") {
+			return false
+		}
+	case tokPunct:
+		switch prev.text {
+		case ")", "]", "}", "!", "++", "--":
+		default:
+			return false
+		}
+	}
+
+	switch next.kind {
+	case tokPunct:
+		switch next.text {
+		case "{", "[", "(", "<", "-":
+			return true
+		default:
+			return false
+		}
+	case tokPrivateName, tokRegexp:
+		return false
+	default:
+		return true
+	}
+}
+
+// isModifier reports whether the token at i is a modifier on a class member
+// rather than a member's name.
+func isModifier(toks []token, i int) bool {
+	if !toks[i].inClass || i+1 >= len(toks) {
+		return false
+	}
+
+	if i > 0 {
+		switch toks[i-1].text {
+		case ".", "?.", "=", ":", ",", "(":
+			return false
+		}
+	}
+
+	// Modifiers can't be followed by a line break.
+	next := toks[i+1]
+	return !next.nl && startsName(next)
+}
+
+func startsName(t token) bool {
+	switch t.kind {
+	case tokIdent, tokPrivateName, tokString, tokNumber:
+		return true
+	case tokPunct:
+		return t.text == "[" || t.text == "*"
+	default:
+		return false
+	}
+}
+
+// isMethod reports whether the class member starting at i, after any
+// modifier already consumed, declares a method.
+func isMethod(toks []token, i int) bool {
+	// Further modifiers, a modifier followed by something that can't start
+	// a name is the member's name instead.
+	for i+1 < len(toks) && toks[i].kind == tokIdent && classModifiers[toks[i].text] && startsName(toks[i+1]) {
+		i++
+	}
+
+	if i < len(toks) && toks[i].text == "*" {
+		i++
+	}
+
+	if i >= len(toks) {
+		return false
+	}
+
+	// The name, a computed name runs to the matching bracket.
+	if toks[i].text == "[" {
+		depth := 0
+		for ; i < len(toks); i++ {
+			if toks[i].text == "[" {
+				depth++
+			} else if toks[i].text == "]" {
+				depth--
+				if depth == 0 {
+					break
+				}
+			}
+		}
+	}
+	i++
+
+	if i < len(toks) && (toks[i].text == "?" || toks[i].text == "!") {
+		i++
+	}
+
+	return i < len(toks) && (toks[i].text == "(" || toks[i].text == "<")
+}
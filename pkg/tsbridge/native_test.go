@@ -0,0 +1,156 @@
+package tsbridge
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectNative(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want map[string]int
+	}{
+		{
+			name: "satisfies operator",
+			src:  "const a = { b: 1 } satisfies T;\nconst c = f() satisfies U;",
+			want: map[string]int{"SatisfiesExpression": 2},
+		},
+		{
+			name: "satisfies as an identifier",
+			src:  "let satisfies = 1;\nsatisfies = 2;\nobj.satisfies(x);\nconst o = { satisfies: true };",
+			want: map[string]int{},
+		},
+		{
+			name: "satisfies after a line break",
+			src:  "const a = b\nsatisfies\n",
+			want: map[string]int{},
+		},
+		{
+			name: "accessor field",
+			src:  "class A {\n  accessor x = 1;\n  static accessor y: number;\n}",
+			want: map[string]int{"AccessorKeyword": 2},
+		},
+		{
+			name: "accessor as a member name",
+			src:  "class A {\n  accessor = 1;\n  accessor() {}\n  accessor\n  x = 2;\n}",
+			want: map[string]int{},
+		},
+		{
+			name: "accessor as an identifier",
+			src:  "const accessor = 1;\nobj.accessor = accessor;\nf(accessor, { accessor });",
+			want: map[string]int{},
+		},
+		{
+			name: "override method",
+			src:  "class A extends B {\n  override m() {}\n  public override async n<T>(x: T) {}\n  override *gen() {}\n  override [key]() {}\n}",
+			want: map[string]int{"OverrideOnClassMethod": 4},
+		},
+		{
+			name: "override field",
+			src:  "class A extends B {\n  override x = 1;\n  override readonly y: string;\n}",
+			want: map[string]int{},
+		},
+		{
+			name: "override as a member name",
+			src:  "class A {\n  override() {}\n  override = 1;\n  m() { this.override(); }\n}",
+			want: map[string]int{},
+		},
+		{
+			name: "modifiers before the name",
+			src:  "class A {\n  private static override readonly m() {}\n  protected accessor #p = 1;\n  declare accessor q: number;\n}",
+			want: map[string]int{"OverrideOnClassMethod": 1, "AccessorKeyword": 2},
+		},
+		{
+			name: "static block",
+			src:  "class A {\n  static {\n    init();\n  }\n}",
+			want: map[string]int{"StaticBlockInClass": 1},
+		},
+		{
+			name: "static field",
+			src:  "class A {\n  static x = {};\n  static y = () => { static: 1 };\n  static m() {}\n}",
+			want: map[string]int{},
+		},
+		{
+			name: "static outside a class",
+			src:  "const o = { static: {} };\nfunction f() { static\n{} }",
+			want: map[string]int{},
+		},
+		{
+			name: "generic class header",
+			src:  "class A<T extends { a: number }> extends B<{ b: T }> implements C<{}> {\n  static {}\n  accessor x = 1;\n}",
+			want: map[string]int{"StaticBlockInClass": 1, "AccessorKeyword": 1},
+		},
+		{
+			name: "extends expression header",
+			src:  "class A extends (mixin({ x: 1 }, class {})) {\n  static {}\n  override m() {}\n}",
+			want: map[string]int{"StaticBlockInClass": 1, "OverrideOnClassMethod": 1},
+		},
+		{
+			name: "class expression",
+			src:  "const A = class extends B {\n  override m() {}\n};\nconst o = { class: 1 };",
+			want: map[string]int{"OverrideOnClassMethod": 1},
+		},
+		{
+			name: "division after a paren or brace",
+			src:  "const a = (b) / 2 / c;\nconst d = {} / e; x ??= 1;\nconst f = g[0] / h / i;",
+			want: map[string]int{"ShortCircuitAssignment": 1},
+		},
+		{
+			name: "regexp",
+			src:  "const a = /??=/g;\nif (x) /||=/.test(s);\nreturn /&&=[/]/;",
+			want: map[string]int{},
+		},
+		{
+			name: "nested template substitutions",
+			src:  "const s = `a ${`b ${c ??= 1} ??=`} ||= ${ {d: 1}.d }`;\nclass A { static {} }",
+			want: map[string]int{"ShortCircuitAssignment": 1, "StaticBlockInClass": 1},
+		},
+		{
+			name: "operators in strings and comments",
+			src:  "const a = '??=', b = \"||=\";\n// c &&= d\n/* e ??= f */\nconst g = `&&=`;",
+			want: map[string]int{},
+		},
+		{
+			name: "short circuit assignment",
+			src:  "a ??= 1;\nb.c ||= 2;\nd[e] &&= f;",
+			want: map[string]int{"ShortCircuitAssignment": 3},
+		},
+		{
+			name: "unicode escapes in identifiers",
+			src:  "const \\u{61}b = 1, c\\u0064 = 2;\nclass A {\n  static {}\n}",
+			want: map[string]int{"StaticBlockInClass": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, _ := detectNative(tt.src, false)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("detectNative(%q) = %v, want %v", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectNativePositions(t *testing.T) {
+	src := "const a = 1;\nclass A {\n  accessor x = 1;\n}\nb ??= a;"
+
+	_, first, matches := detectNative(src, true)
+
+	want := map[string]Position{
+		"AccessorKeyword":        {Line: 3, Column: 3},
+		"ShortCircuitAssignment": {Line: 5, Column: 3},
+	}
+	if !reflect.DeepEqual(first, want) {
+		t.Errorf("first = %v, want %v", first, want)
+	}
+
+	wantMatches := []Match{
+		{Feature: "AccessorKeyword", Line: 3, Column: 3, Snippet: "  accessor x = 1;"},
+		{Feature: "ShortCircuitAssignment", Line: 5, Column: 3, Snippet: "b ??= a;"},
+	}
+	if !reflect.DeepEqual(matches, wantMatches) {
+		t.Errorf("matches = %v, want %v", matches, wantMatches)
+	}
+}
@@ -0,0 +1,216 @@
+package tsbridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/jsdata/v3/pkg/metrics"
+)
+
+const (
+	// ejectAfter is the number of consecutive failed attempts after which a
+	// backend stops receiving requests until a health check passes.
+	ejectAfter = 3
+
+	healthTimeout = 2 * time.Second
+)
+
+var (
+	backendsHealthy  = metrics.NewGauge("tsbridge_backends_healthy", "Backends currently receiving requests.")
+	backendEjections = metrics.NewCounter("tsbridge_backend_ejections_total", "Times a backend was ejected after repeated failures.")
+)
+
+type backend struct {
+	t Transport
+
+	outstanding int64
+	failures    int32
+	healthy     int32
+}
+
+func newBackend(t Transport) *backend {
+	backendsHealthy.Inc()
+	return &backend{t: t, healthy: 1}
+}
+
+func (be *backend) isHealthy() bool {
+	return atomic.LoadInt32(&be.healthy) == 1
+}
+
+func (be *backend) markHealthy() {
+	atomic.StoreInt32(&be.failures, 0)
+	if atomic.CompareAndSwapInt32(&be.healthy, 0, 1) {
+		backendsHealthy.Inc()
+		log.Printf("tsbridge: backend %v is healthy again", be.t)
+	}
+}
+
+func (be *backend) markFailed() {
+	if atomic.AddInt32(&be.failures, 1) < ejectAfter {
+		return
+	}
+	if atomic.CompareAndSwapInt32(&be.healthy, 1, 0) {
+		backendsHealthy.Dec()
+		backendEjections.Inc()
+		log.Printf("tsbridge: ejecting backend %v", be.t)
+	}
+}
+
+// Pool is a Transport balancing requests between several backends. Requests
+// go to the backend with the fewest requests in flight and backends that
+// keep failing are ejected until a periodic health check passes again.
+type Pool struct {
+	backends []*backend
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewPool balances between transports, health checking each of them every
+// interval.
+func NewPool(transports []Transport, interval time.Duration) *Pool {
+	p := &Pool{done: make(chan struct{})}
+
+	for _, t := range transports {
+		p.backends = append(p.backends, newBackend(t))
+	}
+
+	go p.healthLoop(interval)
+
+	return p
+}
+
+// NewHTTPPool creates a pool of HTTPTransports for every address in addrs.
+func NewHTTPPool(addrs []string, interval time.Duration) *Pool {
+	var transports []Transport
+
+	for _, addr := range addrs {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		transports = append(transports, NewHTTPTransport(addr))
+	}
+
+	return NewPool(transports, interval)
+}
+
+// pick returns the healthy backend with the fewest requests in flight. If
+// every backend has been ejected they are all considered so requests keep
+// probing until one recovers.
+func (p *Pool) pick() *backend {
+	var best *backend
+	var bestOutstanding int64
+	ties := 0
+
+	for _, healthyOnly := range []bool{true, false} {
+		for _, be := range p.backends {
+			if healthyOnly && !be.isHealthy() {
+				continue
+			}
+
+			n := atomic.LoadInt64(&be.outstanding)
+
+			switch {
+			case best == nil || n < bestOutstanding:
+				best, bestOutstanding, ties = be, n, 1
+			case n == bestOutstanding:
+				// Reservoir sample between equally loaded backends so
+				// they share the work.
+				ties += 1
+				if rand.Intn(ties) == 0 {
+					best = be
+				}
+			}
+		}
+
+		if best != nil {
+			return best
+		}
+	}
+
+	return nil
+}
+
+// failedAttempt reports whether err means the backend itself is in trouble
+// rather than the request being bad.
+func failedAttempt(err error) bool {
+	if err == nil {
+		return false
+	}
+	return retryable(err) && !errors.Is(err, context.Canceled)
+}
+
+// RoundTrip implements Transport
+func (p *Pool) RoundTrip(ctx context.Context, method string, body []byte) (resp []byte, err error) {
+	be := p.pick()
+	if be == nil {
+		return nil, fmt.Errorf("%w: no backends configured", ErrServerUnavailable)
+	}
+
+	atomic.AddInt64(&be.outstanding, 1)
+	defer func() {
+		atomic.AddInt64(&be.outstanding, -1)
+
+		if failedAttempt(err) {
+			be.markFailed()
+		} else if err == nil {
+			be.markHealthy()
+		}
+	}()
+
+	return be.t.RoundTrip(ctx, method, body)
+}
+
+func (p *Pool) checkHealth(be *backend) {
+	ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
+	defer cancel()
+
+	_, err := be.t.RoundTrip(ctx, "health", nil)
+
+	// Older backends without /health still answer, which is enough to know
+	// the process is up.
+	var serverErr *ServerError
+	if err != nil && !(errors.As(err, &serverErr) && serverErr.StatusCode != http.StatusServiceUnavailable) {
+		be.markFailed()
+		return
+	}
+
+	be.markHealthy()
+}
+
+func (p *Pool) healthLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			for _, be := range p.backends {
+				p.checkHealth(be)
+			}
+		}
+	}
+}
+
+// Close stops the health checks and closes every transport in the pool.
+func (p *Pool) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.done)
+
+		for _, be := range p.backends {
+			be.t.Close()
+		}
+	})
+	return nil
+}
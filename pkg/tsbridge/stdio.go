@@ -0,0 +1,346 @@
+package tsbridge
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var errBackendExited = errors.New("backend process exited")
+
+// stdioRequest is a single line written to the backend's stdin. The backend
+// answers each with a stdioResponse carrying the same ID, not necessarily in
+// the order the requests were written.
+type stdioRequest struct {
+	ID     uint64          `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+type stdioResponse struct {
+	ID     uint64          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  string          `json:"error"`
+	// Status is the HTTP status code the error would have been reported with
+	// so it classifies the same way as over HTTP.
+	Status int `json:"status"`
+}
+
+type stdioResult struct {
+	body []byte
+	err  error
+}
+
+// stdioProcess is a single run of the backend. Requests in flight when it
+// exits fail with errBackendExited.
+type stdioProcess struct {
+	cmd    *exec.Cmd
+	stdin  *os.File
+	exited chan struct{}
+
+	mtx     sync.Mutex
+	pending map[uint64]chan stdioResult
+	err     error
+}
+
+// StdioTransport runs the backend as a child process and exchanges newline
+// delimited JSON with it over stdin and stdout. Any number of requests can
+// be outstanding at once. The process is started on the first request and
+// started again if it exits.
+type StdioTransport struct {
+	command []string
+	maxRSS  int64
+
+	nextID uint64
+
+	mtx     sync.Mutex
+	proc    *stdioProcess
+	started bool
+	closed  bool
+}
+
+// NewStdioTransport creates a transport running command. If maxRSS is
+// positive the process is replaced once a health check reports it using more
+// than that many bytes.
+func NewStdioTransport(command []string, maxRSS int64) *StdioTransport {
+	return &StdioTransport{command: command, maxRSS: maxRSS}
+}
+
+func (t *StdioTransport) String() string {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.proc == nil {
+		return fmt.Sprintf("stdio %q (not running)", strings.Join(t.command, " "))
+	}
+	return fmt.Sprintf("stdio %q (pid %d)", strings.Join(t.command, " "), t.proc.cmd.Process.Pid)
+}
+
+func (t *StdioTransport) start() (*stdioProcess, error) {
+	if len(t.command) == 0 {
+		return nil, fmt.Errorf("no backend command configured")
+	}
+
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(t.command[0], t.command[1:]...)
+	cmd.Stdin = stdinR
+	cmd.Stderr = os.Stderr
+	setProcAttr(cmd)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		stdinR.Close()
+		stdinW.Close()
+		return nil, err
+	}
+
+	err = cmd.Start()
+	stdinR.Close()
+	if err != nil {
+		stdinW.Close()
+		return nil, fmt.Errorf("error launching backend: %v", err)
+	}
+
+	p := &stdioProcess{
+		cmd:     cmd,
+		stdin:   stdinW,
+		exited:  make(chan struct{}),
+		pending: make(map[uint64]chan stdioResult),
+	}
+
+	go t.read(p, stdout)
+
+	return p, nil
+}
+
+// read dispatches responses from the process until its stdout closes.
+func (t *StdioTransport) read(p *stdioProcess, stdout io.Reader) {
+	r := bufio.NewReaderSize(stdout, 1<<16)
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			break
+		}
+
+		var resp stdioResponse
+		if err := json.Unmarshal(line, &resp); err != nil {
+			log.Printf("tsbridge: ignoring invalid line from backend: %v", err)
+			continue
+		}
+
+		result := stdioResult{body: resp.Result}
+		if resp.Error != "" || resp.Status != 0 {
+			status := resp.Status
+			if status == 0 {
+				status = http.StatusInternalServerError
+			}
+			result = stdioResult{err: &ServerError{StatusCode: status, Message: resp.Error}}
+		}
+
+		p.mtx.Lock()
+		ch, ok := p.pending[resp.ID]
+		delete(p.pending, resp.ID)
+		p.mtx.Unlock()
+
+		if ok {
+			ch <- result
+		}
+	}
+
+	p.mtx.Lock()
+	p.err = errBackendExited
+	for id, ch := range p.pending {
+		ch <- stdioResult{err: errBackendExited}
+		delete(p.pending, id)
+	}
+	p.mtx.Unlock()
+
+	p.stdin.Close()
+	p.cmd.Wait()
+	close(p.exited)
+
+	t.mtx.Lock()
+	if t.proc == p {
+		t.proc = nil
+		if !t.closed {
+			log.Printf("tsbridge: stdio backend exited: %v", p.cmd.ProcessState)
+		}
+	}
+	t.mtx.Unlock()
+}
+
+// process returns the running process, starting one if needed.
+func (t *StdioTransport) process() (*stdioProcess, error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.closed {
+		return nil, fmt.Errorf("%w: transport closed", ErrServerUnavailable)
+	}
+
+	if t.proc == nil {
+		p, err := t.start()
+		if err != nil {
+			return nil, err
+		}
+
+		if t.started {
+			backendRestarts.Inc()
+		}
+		t.proc, t.started = p, true
+	}
+
+	return t.proc, nil
+}
+
+// send writes a request line to the process. Writes are serialised so lines
+// are never interleaved.
+func (p *stdioProcess) send(ctx context.Context, line []byte, id uint64) (chan stdioResult, error) {
+	ch := make(chan stdioResult, 1)
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	p.pending[id] = ch
+
+	// A backend that stops reading would otherwise block the write forever.
+	deadline, _ := ctx.Deadline()
+	p.stdin.SetWriteDeadline(deadline)
+
+	_, err := p.stdin.Write(line)
+	if err != nil {
+		delete(p.pending, id)
+		// A partial line leaves the stream unusable so the process has to go.
+		p.cmd.Process.Kill()
+		return nil, err
+	}
+
+	return ch, nil
+}
+
+func (p *stdioProcess) cancel(id uint64) {
+	p.mtx.Lock()
+	delete(p.pending, id)
+	p.mtx.Unlock()
+}
+
+// RoundTrip implements Transport
+func (t *StdioTransport) RoundTrip(ctx context.Context, method string, body []byte) ([]byte, error) {
+	p, err := t.process()
+	if err != nil {
+		return nil, err
+	}
+
+	id := atomic.AddUint64(&t.nextID, 1)
+
+	line, err := json.Marshal(stdioRequest{ID: id, Method: method, Params: body})
+	if err != nil {
+		return nil, err
+	}
+	line = append(line, '\n')
+
+	ch, err := p.send(ctx, line, id)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case res := <-ch:
+		if res.err == nil && method == "health" {
+			t.checkRSS(p, res.body)
+		}
+		return res.body, res.err
+	case <-ctx.Done():
+		p.cancel(id)
+		return nil, ctx.Err()
+	}
+}
+
+// checkRSS retires the process once it grows past maxRSS. Requests already
+// sent to it still complete while new requests go to a fresh process.
+func (t *StdioTransport) checkRSS(p *stdioProcess, body []byte) {
+	if t.maxRSS <= 0 {
+		return
+	}
+
+	var h healthResponse
+	if json.Unmarshal(body, &h) != nil || h.RSS <= t.maxRSS {
+		return
+	}
+
+	t.mtx.Lock()
+	retire := t.proc == p
+	if retire {
+		t.proc = nil
+	}
+	t.mtx.Unlock()
+
+	if retire {
+		log.Printf("tsbridge: stdio backend pid %d using %d MiB, restarting", p.cmd.Process.Pid, h.RSS>>20)
+		go p.retire()
+	}
+}
+
+func (p *stdioProcess) closeStdin() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.err == nil {
+		p.err = errBackendExited
+	}
+	p.stdin.Close()
+}
+
+// retire closes stdin so the process exits once it has answered everything
+// already sent.
+func (p *stdioProcess) retire() {
+	p.closeStdin()
+
+	select {
+	case <-p.exited:
+	case <-time.After(time.Minute):
+		killProcess(p.cmd, p.exited)
+	}
+}
+
+// Close implements Transport
+func (t *StdioTransport) Close() error {
+	t.mtx.Lock()
+	t.closed = true
+	p := t.proc
+	t.mtx.Unlock()
+
+	if p == nil {
+		return nil
+	}
+
+	p.closeStdin()
+
+	select {
+	case <-p.exited:
+	case <-time.After(5 * time.Second):
+		killProcess(p.cmd, p.exited)
+	}
+
+	return nil
+}
@@ -0,0 +1,353 @@
+package tsbridge
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"example.com/jsdata/v3/pkg/metrics"
+)
+
+var (
+	transportKind = flag.String("transport", "http", "How to talk to the backends: http to connect to -addr (or launch -spawn backends listening on ports), stdio to launch -spawn backends and talk to them over stdin and stdout.")
+	spawnBackends = flag.Int("spawn", 0, "If set, launch this many backends as child processes instead of connecting to -addr.")
+	backendCmd    = flag.String("backend-cmd", "node build/src", "The command used to launch a backend, it must listen on $PORT or with -transport stdio accept --stdio.")
+	backendMaxRSS = flag.Int64("backend-max-rss", 2048, "Restart a launched backend once its resident memory exceeds this many MiB. 0 disables the limit.")
+)
+
+var (
+	backendRestarts = metrics.NewCounter("tsbridge_backend_restarts_total", "Times a launched backend was restarted after crashing or bloating.")
+)
+
+type SupervisorConfig struct {
+	// Command is the program and arguments to launch. The port to listen on
+	// is passed in the PORT environment variable.
+	Command []string
+	// MaxRSS restarts the backend once it reports using more than this many
+	// bytes. Zero disables the limit.
+	MaxRSS int64
+	// ReadyTimeout bounds how long to wait for a launched backend to answer
+	// its health check.
+	ReadyTimeout time.Duration
+	// CheckInterval is how often the backend's memory use is checked.
+	CheckInterval time.Duration
+}
+
+// Supervisor runs a backend as a child process on a free local port. It
+// restarts the backend if it exits unexpectedly or grows past MaxRSS and
+// kills it on Stop.
+type Supervisor struct {
+	cfg    SupervisorConfig
+	addr   string
+	client *http.Client
+
+	mtx      sync.Mutex
+	cmd      *exec.Cmd
+	exited   chan struct{}
+	stopping bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewSupervisor(cfg SupervisorConfig) *Supervisor {
+	if cfg.ReadyTimeout == 0 {
+		cfg.ReadyTimeout = 60 * time.Second
+	}
+	if cfg.CheckInterval == 0 {
+		cfg.CheckInterval = 10 * time.Second
+	}
+
+	return &Supervisor{
+		cfg:    cfg,
+		client: &http.Client{Transport: connPool, Timeout: healthTimeout},
+		done:   make(chan struct{}),
+	}
+}
+
+// Addr returns the host:port the backend listens on. It is only valid after
+// Start returns.
+func (s *Supervisor) Addr() string {
+	return s.addr
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// Start launches the backend and waits for it to become ready.
+func (s *Supervisor) Start(ctx context.Context) error {
+	if len(s.cfg.Command) == 0 {
+		return fmt.Errorf("no backend command configured")
+	}
+
+	port, err := freePort()
+	if err != nil {
+		return err
+	}
+
+	s.addr = fmt.Sprintf("localhost:%d", port)
+
+	err = s.launch(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.wg.Add(1)
+	go s.monitor()
+
+	return nil
+}
+
+func (s *Supervisor) launch(ctx context.Context) error {
+	_, port, _ := net.SplitHostPort(s.addr)
+
+	cmd := exec.Command(s.cfg.Command[0], s.cfg.Command[1:]...)
+	cmd.Env = append(os.Environ(), "PORT="+port)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	setProcAttr(cmd)
+
+	err := cmd.Start()
+	if err != nil {
+		return fmt.Errorf("error launching backend: %v", err)
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+
+	s.mtx.Lock()
+	s.cmd = cmd
+	s.exited = exited
+	s.mtx.Unlock()
+
+	err = s.waitReady(ctx, exited)
+	if err != nil {
+		killProcess(cmd, exited)
+		return err
+	}
+
+	log.Printf("tsbridge: backend pid %d ready on %s", cmd.Process.Pid, s.addr)
+
+	return nil
+}
+
+func (s *Supervisor) waitReady(ctx context.Context, exited chan struct{}) error {
+	deadline := time.Now().Add(s.cfg.ReadyTimeout)
+
+	for {
+		if _, err := s.health(); err == nil {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("backend on %s not ready after %v", s.addr, s.cfg.ReadyTimeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-exited:
+			return fmt.Errorf("backend on %s exited before becoming ready", s.addr)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+type healthResponse struct {
+	Status  string `json:"status"`
+	Version int    `json:"version"`
+	RSS     int64  `json:"rss"`
+}
+
+func (s *Supervisor) health() (healthResponse, error) {
+	res, err := s.client.Get(fmt.Sprintf("http://%s/health", s.addr))
+	if err != nil {
+		return healthResponse{}, err
+	}
+	defer func() {
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return healthResponse{}, &ServerError{StatusCode: res.StatusCode}
+	}
+
+	var ret healthResponse
+
+	err = json.NewDecoder(res.Body).Decode(&ret)
+	if err != nil {
+		return healthResponse{}, err
+	}
+
+	return ret, nil
+}
+
+// monitor restarts the backend whenever it exits or exceeds MaxRSS.
+func (s *Supervisor) monitor() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.cfg.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		s.mtx.Lock()
+		cmd, exited := s.cmd, s.exited
+		s.mtx.Unlock()
+
+		select {
+		case <-s.done:
+			return
+		case <-exited:
+			log.Printf("tsbridge: backend on %s exited: %v", s.addr, cmd.ProcessState)
+		case <-ticker.C:
+			if s.cfg.MaxRSS <= 0 {
+				continue
+			}
+
+			h, err := s.health()
+			if err != nil || h.RSS <= s.cfg.MaxRSS {
+				continue
+			}
+
+			log.Printf("tsbridge: backend on %s using %d MiB, restarting", s.addr, h.RSS>>20)
+			killProcess(cmd, exited)
+		}
+
+		backendRestarts.Inc()
+
+		for {
+			err := s.launch(context.Background())
+			if err == nil {
+				break
+			}
+
+			log.Printf("tsbridge: error restarting backend: %v", err)
+
+			select {
+			case <-s.done:
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	}
+}
+
+// killProcess asks the process to exit and forces it if it hasn't within a
+// few seconds.
+func killProcess(cmd *exec.Cmd, exited chan struct{}) {
+	cmd.Process.Signal(syscall.SIGTERM)
+
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		cmd.Process.Kill()
+		<-exited
+	}
+}
+
+// Stop shuts the backend down and stops restarting it.
+func (s *Supervisor) Stop() error {
+	s.mtx.Lock()
+	if s.stopping {
+		s.mtx.Unlock()
+		return nil
+	}
+	s.stopping = true
+	s.mtx.Unlock()
+
+	close(s.done)
+	s.wg.Wait()
+
+	s.mtx.Lock()
+	cmd, exited := s.cmd, s.exited
+	s.mtx.Unlock()
+
+	if cmd != nil {
+		killProcess(cmd, exited)
+	}
+
+	return nil
+}
+
+// StartBridge returns a bridge to the backends given by the -addr flag, or
+// when -spawn is set launches that many supervised backends and returns a
+// bridge balancing between them. With -transport stdio the backends are
+// always launched, at least one of them. Closing the bridge stops any
+// backends it launched.
+func StartBridge(ctx context.Context) (*Bridge, error) {
+	switch *transportKind {
+	case "http":
+	case "stdio":
+		return startStdioBridge(), nil
+	default:
+		return nil, fmt.Errorf("unknown transport %q", *transportKind)
+	}
+
+	if *spawnBackends <= 0 {
+		return NewBridge(""), nil
+	}
+
+	var supervisors []*Supervisor
+	var addrs []string
+
+	for i := 0; i < *spawnBackends; i++ {
+		s := NewSupervisor(SupervisorConfig{
+			Command: strings.Fields(*backendCmd),
+			MaxRSS:  *backendMaxRSS << 20,
+		})
+
+		err := s.Start(ctx)
+		if err != nil {
+			for _, s := range supervisors {
+				s.Stop()
+			}
+			return nil, err
+		}
+
+		supervisors = append(supervisors, s)
+		addrs = append(addrs, s.Addr())
+	}
+
+	b := NewBridgePool(addrs)
+	b.supervisors = supervisors
+
+	return b, nil
+}
+
+func startStdioBridge() *Bridge {
+	n := *spawnBackends
+	if n <= 0 {
+		n = 1
+	}
+
+	command := append(strings.Fields(*backendCmd), "--stdio")
+
+	var transports []Transport
+	for i := 0; i < n; i++ {
+		transports = append(transports, NewStdioTransport(command, *backendMaxRSS<<20))
+	}
+
+	return NewBridgeTransport(NewPool(transports, *healthInterval))
+}
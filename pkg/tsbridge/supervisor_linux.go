@@ -0,0 +1,12 @@
+package tsbridge
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcAttr makes sure the backend dies with us even if we exit without
+// running Stop, for example from log.Fatal.
+func setProcAttr(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL}
+}
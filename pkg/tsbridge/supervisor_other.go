@@ -0,0 +1,7 @@
+//go:build !linux
+
+package tsbridge
+
+import "os/exec"
+
+func setProcAttr(cmd *exec.Cmd) {}
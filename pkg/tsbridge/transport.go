@@ -0,0 +1,106 @@
+package tsbridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Transport carries an encoded request to a backend and returns the encoded
+// response. method names the backend operation, one of "process",
+// "processBatch" or "health", and a nil body asks for an operation that
+// takes no arguments. A backend that answers with an error is reported as a
+// *ServerError.
+type Transport interface {
+	RoundTrip(ctx context.Context, method string, body []byte) ([]byte, error)
+	Close() error
+}
+
+// connPool is shared by every HTTPTransport so connections to the backend are
+// kept alive and reused across calls instead of being opened per file.
+var connPool = &http.Transport{
+	Proxy: nil,
+	DialContext: (&net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	MaxIdleConns:        256,
+	MaxIdleConnsPerHost: 256,
+	IdleConnTimeout:     90 * time.Second,
+	DisableCompression:  true,
+}
+
+// HTTPTransport sends each request as a POST to /<method> on a backend
+// listening on addr.
+type HTTPTransport struct {
+	addr   string
+	client *http.Client
+}
+
+func NewHTTPTransport(addr string) *HTTPTransport {
+	return &HTTPTransport{
+		addr:   addr,
+		client: &http.Client{Transport: connPool},
+	}
+}
+
+func (t *HTTPTransport) String() string {
+	return t.addr
+}
+
+// RoundTrip implements Transport
+func (t *HTTPTransport) RoundTrip(ctx context.Context, method string, body []byte) ([]byte, error) {
+	httpMethod := http.MethodPost
+	var reqBody io.Reader = bytes.NewReader(body)
+	if body == nil {
+		httpMethod, reqBody = http.MethodGet, nil
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, httpMethod, fmt.Sprintf("http://%s/%s", t.addr, method), reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := t.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		// Drain whatever is left so the connection goes back to the pool.
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}()
+
+	respBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		serverErr := &ServerError{StatusCode: res.StatusCode}
+
+		var payload struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(respBody, &payload) == nil {
+			serverErr.Message = payload.Error
+		}
+
+		return nil, serverErr
+	}
+
+	return respBody, nil
+}
+
+// Close implements Transport
+func (t *HTTPTransport) Close() error {
+	return nil
+}
@@ -1,83 +1,316 @@
 package tsbridge
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
-	"net/http"
+	"math/rand"
+	"strings"
+	"sync"
 	"time"
+
+	"example.com/jsdata/v3/pkg/metrics"
 )
 
 var (
-	defaultAddress = flag.String("addr", "localhost:5123", "The address of the backend TypeScript server.")
+	defaultAddress = flag.String("addr", "localhost:5123", "The address of the backend TypeScript server, or a comma separated list of servers to balance between.")
+	healthInterval = flag.Duration("health-interval", 5*time.Second, "How often to health check backends.")
+	defaultTimeout = flag.Duration("bridge-timeout", 30*time.Second, "The deadline for a single attempt at a backend request.")
+)
+
+var (
+	requestLatency = metrics.NewHistogram("tsbridge_request_duration_seconds", "Latency of successful backend calls including retries.", metrics.ExponentialBuckets(0.0005, 2, 16))
+	requestsTotal  = metrics.NewCounter("tsbridge_requests_total", "Backend calls made.")
+	retriesTotal   = metrics.NewCounter("tsbridge_retries_total", "Backend attempts that failed and were retried.")
+	failuresTotal  = metrics.NewCounter("tsbridge_failures_total", "Backend calls that failed after every retry.")
+
+	parseFailuresTotal = metrics.NewCounter("tsbridge_parse_failures_total", "Backend calls rejected because the file could not be processed.")
 )
 
 type Request struct {
 	Filename     string `json:"filename"`
 	FileContents string `json:"fileContents"`
+	// Kind is the file's extension without the dot, such as "ts" or "tsx",
+	// and decides how the backend parses it. Empty means "ts".
+	Kind string `json:"kind,omitempty"`
+	// Matches asks for every match of every feature in Response.Matches.
+	Matches bool `json:"matches,omitempty"`
+}
+
+// KindOf returns the Request.Kind for a file name, its extension without
+// the dot in lower case.
+func KindOf(filename string) string {
+	i := strings.LastIndexByte(filename, '.')
+	if i < 0 || strings.ContainsAny(filename[i:], "/\\") {
+		return ""
+	}
+	return strings.ToLower(filename[i+1:])
+}
+
+// Position is a 1-based line and column in a file, the column counted in
+// UTF-16 code units like TypeScript does.
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// SnippetLength is the most UTF-16 code units of a line a Match's snippet
+// holds.
+const SnippetLength = 120
+
+// Match is a single use of a feature in a file.
+type Match struct {
+	Feature string `json:"feature"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	// Snippet is the line the match starts on without its line break, cut
+	// to SnippetLength.
+	Snippet string `json:"snippet"`
 }
 
 type Response struct {
 	Version     int             `json:"version"`
 	ProcessTime uint64          `json:"processTime"`
 	Features    map[string]bool `json:"features"`
+	Counts      map[string]int  `json:"counts"`
+	// First is where each feature first appears, from protocol version 5.
+	First map[string]Position `json:"first,omitempty"`
+	// Matches lists every match in source order when the request asked for
+	// them, from protocol version 6.
+	Matches []Match `json:"matches,omitempty"`
+	// Error is set instead of the features when the file could not be
+	// processed.
+	Error string `json:"error,omitempty"`
+}
+
+// Count returns the number of occurrences of feature. Backends older than
+// protocol version 3 only report presence so a present feature counts once.
+func (r Response) Count(feature string) int {
+	if n, ok := r.Counts[feature]; ok {
+		return n
+	}
+	if r.Features[feature] {
+		return 1
+	}
+	return 0
 }
 
 type Bridge struct {
-	addr string
+	transport Transport
+	timeout   time.Duration
+
+	// supervisors are the backends launched by StartBridge.
+	supervisors []*Supervisor
+
+	closeOnce sync.Once
 }
 
+// Call is CallContext without cancellation.
 func (b *Bridge) Call(req Request) (Response, error) {
-	var err error
+	return b.CallContext(context.Background(), req)
+}
 
-	left := 10
+const (
+	maxAttempts = 9
+	backoffBase = 10 * time.Millisecond
+	backoffMax  = 2 * time.Second
+)
 
-	for {
-		left -= 1
-		if left == 0 {
-			return Response{}, fmt.Errorf("Call failed: %v", err)
+// backoff returns a random delay before the given retry, with the upper bound
+// doubling every attempt.
+func backoff(attempt int) time.Duration {
+	d := backoffMax
+	if attempt < 16 {
+		d = backoffBase << attempt
+		if d > backoffMax {
+			d = backoffMax
 		}
+	}
+	return time.Duration(rand.Int63n(int64(d))) + time.Millisecond
+}
+
+func retryable(err error) bool {
+	var serverErr *ServerError
+	if errors.As(err, &serverErr) {
+		return serverErr.Temporary()
+	}
+	return !errors.Is(err, ErrParseFailed)
+}
+
+type batchRequest struct {
+	Requests []Request `json:"requests"`
+}
 
-		body := new(bytes.Buffer)
+type batchResponse struct {
+	Responses []Response `json:"responses"`
+}
+
+// CallContext sends req to the backend. Transport errors, timeouts,
+// responses that don't decode and temporary server errors are retried with
+// exponential backoff, errors
+// processing the file are returned straight away and match ErrParseFailed.
+// Each attempt is bounded by the bridge's request timeout and the whole call
+// stops as soon as ctx is done.
+func (b *Bridge) CallContext(ctx context.Context, req Request) (Response, error) {
+	var resp Response
 
-		enc := json.NewEncoder(body)
+	err := b.call(ctx, "process", &req, &resp)
+	if err != nil {
+		return Response{}, err
+	}
+
+	return resp, nil
+}
 
-		err = enc.Encode(&req)
+// CallBatch is CallBatchContext without cancellation.
+func (b *Bridge) CallBatch(reqs []Request) ([]Response, error) {
+	return b.CallBatchContext(context.Background(), reqs)
+}
+
+// CallBatchContext sends every request to the backend in a single round-trip
+// and returns the responses in the same order. A file the backend fails to
+// process has Error set on its response rather than failing the batch.
+func (b *Bridge) CallBatchContext(ctx context.Context, reqs []Request) ([]Response, error) {
+	var resp batchResponse
+
+	err := b.call(ctx, "processBatch", &batchRequest{Requests: reqs}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Responses) != len(reqs) {
+		return nil, fmt.Errorf("%w: batch of %d returned %d responses", ErrParseFailed, len(reqs), len(resp.Responses))
+	}
+
+	return resp.Responses, nil
+}
+
+func (b *Bridge) call(ctx context.Context, method string, in interface{}, out interface{}) error {
+	requestsTotal.Inc()
+
+	start := time.Now()
+
+	// A nil body asks the transport for an operation without arguments.
+	var body []byte
+	if in != nil {
+		var err error
+		body, err = json.Marshal(in)
 		if err != nil {
-			time.Sleep(10 * time.Millisecond)
-			continue
+			failuresTotal.Inc()
+			return err
 		}
+	}
 
-		res, err := http.Post(fmt.Sprintf("http://%s/process", b.addr), "application/json", body)
-		if err != nil {
-			time.Sleep(10 * time.Millisecond)
-			continue
+	var lastErr error
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			retriesTotal.Inc()
+
+			select {
+			case <-ctx.Done():
+				failuresTotal.Inc()
+				return ctx.Err()
+			case <-time.After(backoff(attempt)):
+			}
 		}
 
-		var resp Response
+		err := b.attempt(ctx, method, body, out)
+		if err == nil {
+			requestLatency.Observe(time.Since(start).Seconds())
+			return nil
+		}
 
-		respBody, err := io.ReadAll(res.Body)
-		if err != nil {
-			time.Sleep(10 * time.Millisecond)
-			continue
+		if ctx.Err() != nil {
+			failuresTotal.Inc()
+			return ctx.Err()
 		}
 
-		err = json.Unmarshal(respBody, &resp)
-		if err != nil {
-			time.Sleep(10 * time.Millisecond)
-			continue
+		if !retryable(err) {
+			if errors.Is(err, ErrParseFailed) {
+				parseFailuresTotal.Inc()
+			} else {
+				failuresTotal.Inc()
+			}
+			return err
+		}
+
+		lastErr = err
+	}
+
+	failuresTotal.Inc()
+
+	if errors.Is(lastErr, ErrTimeout) || errors.Is(lastErr, ErrServerUnavailable) {
+		return fmt.Errorf("%w (after %d attempts)", lastErr, maxAttempts)
+	}
+	return fmt.Errorf("%w: %v (after %d attempts)", ErrServerUnavailable, lastErr, maxAttempts)
+}
+
+func (b *Bridge) attempt(ctx context.Context, method string, body []byte, out interface{}) error {
+	attemptCtx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+
+	respBody, err := b.transport.RoundTrip(attemptCtx, method, body)
+	if err != nil {
+		if ctx.Err() == nil && attemptCtx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("%w: %v", ErrTimeout, err)
 		}
+		return err
+	}
+
+	// A *[]byte asks for the response undecoded.
+	if raw, ok := out.(*[]byte); ok {
+		*raw = respBody
+		return nil
+	}
 
-		return resp, nil
+	// A response that doesn't decode was cut short or garbled on the way,
+	// likely by a backend that is going down, not a verdict on the file.
+	err = json.Unmarshal(respBody, out)
+	if err != nil {
+		return fmt.Errorf("invalid response: %v", err)
 	}
+
+	return nil
 }
 
+// NewBridge creates a bridge to the backends in addr, a comma separated list
+// of host:port pairs. Requests go to the backend with the fewest requests in
+// flight and backends that keep failing are ejected until a periodic health
+// check passes again.
 func NewBridge(addr string) *Bridge {
 	if addr == "" {
 		addr = *defaultAddress
 	}
 
-	return &Bridge{addr: addr}
+	return NewBridgePool(strings.Split(addr, ","))
+}
+
+// NewBridgePool creates a bridge balancing requests between every address in
+// addrs.
+func NewBridgePool(addrs []string) *Bridge {
+	return NewBridgeTransport(NewHTTPPool(addrs, *healthInterval))
+}
+
+// NewBridgeTransport creates a bridge sending requests over t. The bridge
+// owns t and closes it along with itself.
+func NewBridgeTransport(t Transport) *Bridge {
+	return &Bridge{
+		transport: t,
+		timeout:   *defaultTimeout,
+	}
+}
+
+// Close closes the transport and stops any backends launched for the bridge.
+func (b *Bridge) Close() error {
+	b.closeOnce.Do(func() {
+		b.transport.Close()
+
+		for _, s := range b.supervisors {
+			s.Stop()
+		}
+	})
+	return nil
 }
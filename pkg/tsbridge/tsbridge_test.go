@@ -0,0 +1,82 @@
+package tsbridge
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// TestCallRetriesInvalidResponse checks a response cut short is retried
+// rather than reported as the file failing to parse.
+func TestCallRetriesInvalidResponse(t *testing.T) {
+	var calls int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			w.Write([]byte(`{"version":6,"features":{"Satisfies`))
+			return
+		}
+		w.Write([]byte(`{"version":6,"features":{"SatisfiesExpression":true},"counts":{"SatisfiesExpression":2}}`))
+	}))
+	defer server.Close()
+
+	b := NewBridgePool([]string{strings.TrimPrefix(server.URL, "http://")})
+	defer b.Close()
+
+	resp, err := b.CallContext(context.Background(), Request{Filename: "a.ts", FileContents: "x satisfies T"})
+	if err != nil {
+		t.Fatalf("CallContext() error = %v", err)
+	}
+
+	if got := resp.Count("SatisfiesExpression"); got != 2 {
+		t.Errorf("Count(SatisfiesExpression) = %d, want 2", got)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("backend called %d times, want 3", got)
+	}
+}
+
+// TestCallParseFailed checks errors the backend reports for the file aren't
+// retried.
+func TestCallParseFailed(t *testing.T) {
+	var calls int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":"Error: cannot parse"}`))
+	}))
+	defer server.Close()
+
+	b := NewBridgePool([]string{strings.TrimPrefix(server.URL, "http://")})
+	defer b.Close()
+
+	_, err := b.CallContext(context.Background(), Request{Filename: "a.ts"})
+	if !errors.Is(err, ErrParseFailed) {
+		t.Errorf("CallContext() error = %v, want ErrParseFailed", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("backend called %d times, want 1", got)
+	}
+}
+
+func TestKindOf(t *testing.T) {
+	tests := map[string]string{
+		"a.ts":          "ts",
+		"src/App.TSX":   "tsx",
+		"lib/index.mts": "mts",
+		"types.d.ts":    "ts",
+		"dir.v2/file":   "",
+		"Makefile":      "",
+	}
+
+	for filename, want := range tests {
+		if got := KindOf(filename); got != want {
+			t.Errorf("KindOf(%q) = %q, want %q", filename, got, want)
+		}
+	}
+}
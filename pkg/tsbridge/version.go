@@ -0,0 +1,106 @@
+package tsbridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ProtocolVersion is the version of the request and response format this
+// package speaks. It matches CURRENT_VERSION in src/index.ts.
+const ProtocolVersion = 6
+
+// VersionInfo is the backend's answer to the version handshake.
+type VersionInfo struct {
+	// Protocol is the backend's request and response format version.
+	Protocol int `json:"protocol"`
+	// DetectorVersion changes whenever the backend's detectors change what
+	// they report.
+	DetectorVersion int `json:"detectorVersion"`
+	// Detectors are the names of every feature the backend can report.
+	Detectors []string `json:"detectors"`
+	// TypeScript is the version of the compiler the backend parses with.
+	TypeScript string `json:"typescript"`
+	// Native is set for NativeDetector, which has no backend.
+	Native bool `json:"-"`
+}
+
+// Key identifies everything that affects the backend's results, it changes
+// whenever the protocol, detectors or compiler do.
+func (v VersionInfo) Key() string {
+	if v.Native {
+		return fmt.Sprintf("native-d%d", v.DetectorVersion)
+	}
+	return fmt.Sprintf("v%d-d%d-ts%s", v.Protocol, v.DetectorVersion, v.TypeScript)
+}
+
+func (v VersionInfo) String() string {
+	if v.Native {
+		return fmt.Sprintf("native detector version %d, %d detectors", v.DetectorVersion, len(v.Detectors))
+	}
+	return fmt.Sprintf("protocol %d, detector version %d, TypeScript %s, %d detectors", v.Protocol, v.DetectorVersion, v.TypeScript, len(v.Detectors))
+}
+
+// Check returns an error describing how the backend differs from what the
+// caller expects: a protocol other than ProtocolVersion or any of the
+// detectors in expected missing.
+func (v VersionInfo) Check(expected []string) error {
+	var problems []string
+
+	if v.Protocol != ProtocolVersion {
+		problems = append(problems, fmt.Sprintf("backend speaks protocol %d, expected %d", v.Protocol, ProtocolVersion))
+	}
+
+	has := make(map[string]bool, len(v.Detectors))
+	for _, name := range v.Detectors {
+		has[name] = true
+	}
+
+	var missing []string
+	for _, name := range expected {
+		if !has[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		problems = append(problems, fmt.Sprintf("backend is missing detectors %s", strings.Join(missing, ", ")))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("version mismatch: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// Version performs the version handshake. Backends from before the
+// handshake existed fail with an error matching ErrUnsupported: depending on
+// the version they answer /version with an error status, often a 500 from
+// trying to process an empty request, or with something that isn't a
+// version at all.
+func (b *Bridge) Version(ctx context.Context) (VersionInfo, error) {
+	var body []byte
+
+	err := b.call(ctx, "version", nil, &body)
+
+	// Statuses that mean the backend is overloaded or restarting have
+	// already been retried, if it still isn't answering it is down rather
+	// than old.
+	var serverErr *ServerError
+	if errors.As(err, &serverErr) && !serverErr.Temporary() {
+		return VersionInfo{}, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	} else if err != nil {
+		return VersionInfo{}, err
+	}
+
+	var ret VersionInfo
+
+	err = json.Unmarshal(body, &ret)
+	if err != nil {
+		return VersionInfo{}, fmt.Errorf("%w: invalid version response: %v", ErrUnsupported, err)
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,79 @@
+package tsbridge
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestVersionPredatesHandshake checks the ways backends from before the
+// handshake answer /version are all reported as ErrUnsupported.
+func TestVersionPredatesHandshake(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{
+			// Every path used to go to processRequest, which fails to
+			// parse the empty body.
+			name: "500",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(`{"Error":"SyntaxError: Unexpected end of JSON input"}`))
+			},
+		},
+		{
+			name: "404",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.NotFound(w, r)
+			},
+		},
+		{
+			name: "not json",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("ok"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			b := NewBridgePool([]string{strings.TrimPrefix(server.URL, "http://")})
+			defer b.Close()
+
+			_, err := b.Version(context.Background())
+			if !errors.Is(err, ErrUnsupported) {
+				t.Errorf("Version() error = %v, want ErrUnsupported", err)
+			}
+		})
+	}
+}
+
+func TestVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"protocol":6,"detectorVersion":1,"detectors":["SatisfiesExpression"],"typescript":"4.9.4"}`))
+	}))
+	defer server.Close()
+
+	b := NewBridgePool([]string{strings.TrimPrefix(server.URL, "http://")})
+	defer b.Close()
+
+	v, err := b.Version(context.Background())
+	if err != nil {
+		t.Fatalf("Version() error = %v", err)
+	}
+
+	if got, want := v.Key(), "v6-d1-ts4.9.4"; got != want {
+		t.Errorf("Key() = %q, want %q", got, want)
+	}
+}
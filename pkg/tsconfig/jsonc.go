@@ -0,0 +1,59 @@
+package tsconfig
+
+// StripComments turns the JSON with comments TypeScript accepts into plain
+// JSON by blanking out line and block comments and dropping trailing commas
+// before a closing bracket or brace.
+func StripComments(src []byte) []byte {
+	ret := make([]byte, 0, len(src))
+
+	// lastComma is the index in ret of a comma that may turn out to be
+	// trailing, or -1.
+	lastComma := -1
+
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+
+		switch {
+		case c == '"':
+			start := i
+			for i++; i < len(src) && src[i] != '"'; i++ {
+				if src[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(src) {
+				i = len(src) - 1
+			}
+			ret = append(ret, src[start:i+1]...)
+			lastComma = -1
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			ret = append(ret, '\n')
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			i += 2
+			for i+1 < len(src) && !(src[i] == '*' && src[i+1] == '/') {
+				i++
+			}
+			i++
+			ret = append(ret, ' ')
+		case c == ',':
+			lastComma = len(ret)
+			ret = append(ret, c)
+		case c == '}' || c == ']':
+			if lastComma >= 0 {
+				ret[lastComma] = ' '
+			}
+			lastComma = -1
+			ret = append(ret, c)
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			ret = append(ret, c)
+		default:
+			lastComma = -1
+			ret = append(ret, c)
+		}
+	}
+
+	return ret
+}
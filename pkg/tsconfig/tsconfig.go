@@ -0,0 +1,231 @@
+package tsconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Options are the compiler options recorded, in column order.
+var Options = []string{
+	"target",
+	"module",
+	"moduleResolution",
+	"strict",
+	"useDefineForClassFields",
+	"verbatimModuleSyntax",
+	"experimentalDecorators",
+	"isolatedModules",
+	"jsx",
+}
+
+// Config is a tsconfig.json with its extends chain applied.
+type Config struct {
+	// Path is the tsconfig.json the chain starts from.
+	Path string
+	// Options holds the value of each compiler option in Options that is
+	// set, strings lowercased since TypeScript ignores their case.
+	Options map[string]string
+}
+
+type file struct {
+	Extends         json.RawMessage            `json:"extends"`
+	CompilerOptions map[string]json.RawMessage `json:"compilerOptions"`
+}
+
+// Loader reads tsconfig files from a repository's commits. Parsed files are
+// kept by blob hash. It isn't safe for concurrent use.
+type Loader struct {
+	files map[plumbing.Hash]*file
+}
+
+func NewLoader() *Loader {
+	return &Loader{files: make(map[plumbing.Hash]*file)}
+}
+
+// Find loads the tsconfig.json in dir, or the nearest directory above it
+// that has one. It returns nil if there isn't one.
+func (l *Loader) Find(tree *object.Tree, dir string) (*Config, error) {
+	for d := dir; ; d = parent(d) {
+		filename := path.Join(d, "tsconfig.json")
+
+		f, err := l.read(tree, filename)
+		if err != nil {
+			return nil, err
+		}
+		if f != nil {
+			return l.resolve(tree, filename, f)
+		}
+
+		if d == "" {
+			return nil, nil
+		}
+	}
+}
+
+// resolve applies the extends chain, later files overriding the options of
+// the ones they extend. Files outside the tree, such as packages that
+// aren't committed, are skipped.
+func (l *Loader) resolve(tree *object.Tree, filename string, f *file) (*Config, error) {
+	cfg := &Config{Path: filename, Options: make(map[string]string)}
+
+	// chain is in override order, each file after the ones it extends.
+	var chain []*file
+	seen := map[string]bool{filename: true}
+
+	var walk func(filename string, f *file) error
+	walk = func(filename string, f *file) error {
+		for _, spec := range extendsList(f.Extends) {
+			for _, candidate := range candidates(path.Dir(filename), spec) {
+				if seen[candidate] {
+					continue
+				}
+
+				base, err := l.read(tree, candidate)
+				if err != nil {
+					return err
+				}
+				if base == nil {
+					continue
+				}
+
+				seen[candidate] = true
+				err = walk(candidate, base)
+				if err != nil {
+					return err
+				}
+				chain = append(chain, base)
+				break
+			}
+		}
+		return nil
+	}
+
+	err := walk(filename, f)
+	if err != nil {
+		return nil, err
+	}
+	chain = append(chain, f)
+
+	for _, f := range chain {
+		for _, name := range Options {
+			raw, ok := f.CompilerOptions[name]
+			if !ok {
+				continue
+			}
+			cfg.Options[name] = value(raw)
+		}
+	}
+
+	return cfg, nil
+}
+
+// extendsList returns the files extended, a string or since TypeScript 5.0
+// a list of them.
+func extendsList(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var one string
+	if json.Unmarshal(raw, &one) == nil {
+		return []string{one}
+	}
+
+	var many []string
+	json.Unmarshal(raw, &many)
+	return many
+}
+
+// candidates returns the paths extends may refer to from dir, in the order
+// TypeScript tries them. Packages are looked for in node_modules.
+func candidates(dir string, spec string) []string {
+	var bases []string
+
+	if strings.HasPrefix(spec, "./") || strings.HasPrefix(spec, "../") {
+		bases = []string{path.Join(dir, spec)}
+	} else if strings.HasPrefix(spec, "/") {
+		return nil
+	} else {
+		for d := dir; ; d = parent(d) {
+			bases = append(bases, path.Join(d, "node_modules", spec))
+			if d == "" || d == "." {
+				break
+			}
+		}
+	}
+
+	var ret []string
+	for _, base := range bases {
+		if base == ".." || strings.HasPrefix(base, "../") {
+			continue
+		}
+		if strings.HasSuffix(base, ".json") {
+			ret = append(ret, base)
+		} else {
+			ret = append(ret, base+".json", path.Join(base, "tsconfig.json"))
+		}
+	}
+
+	return ret
+}
+
+func value(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return strings.ToLower(s)
+	}
+	return string(raw)
+}
+
+func parent(dir string) string {
+	if i := strings.LastIndexByte(dir, '/'); i >= 0 {
+		return dir[:i]
+	}
+	return ""
+}
+
+// read returns the parsed file at filename or nil if there isn't one or it
+// can't be parsed.
+func (l *Loader) read(tree *object.Tree, filename string) (*file, error) {
+	ent, err := tree.FindEntry(filename)
+	if err == object.ErrEntryNotFound || err == object.ErrDirectoryNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if !ent.Mode.IsFile() {
+		return nil, nil
+	}
+
+	if f, ok := l.files[ent.Hash]; ok {
+		return f, nil
+	}
+
+	blob, err := tree.TreeEntryFile(ent)
+	if err == plumbing.ErrObjectNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", filename, err)
+	}
+
+	contents, err := blob.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", filename, err)
+	}
+
+	var f *file
+	var parsed file
+	if json.Unmarshal(StripComments([]byte(contents)), &parsed) == nil {
+		f = &parsed
+	}
+
+	// Broken files are remembered too so they are only parsed once.
+	l.files[ent.Hash] = f
+
+	return f, nil
+}
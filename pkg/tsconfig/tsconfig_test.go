@@ -0,0 +1,193 @@
+package tsconfig
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+func TestStripComments(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`{"a": 1}`, `{"a": 1}`},
+		{"{\n  // comment\n  \"a\": 1\n}", `{"a": 1}`},
+		{`{/* a */"a": /* b */ 1}`, `{"a": 1}`},
+		{`{"a": "http://example.com/*x*/"}`, `{"a": "http://example.com/*x*/"}`},
+		{`{"a": "// not a comment"}`, `{"a": "// not a comment"}`},
+		{`{"a": "quote \" // still a string", "b": 2}`, `{"a": "quote \" // still a string", "b": 2}`},
+		{`{"a": "ends with \\", "b": 2}`, `{"a": "ends with \\", "b": 2}`},
+		{`{"a": [1, 2,], "b": {"c": 3,},}`, `{"a": [1, 2], "b": {"c": 3}}`},
+		{"{\"a\": 1, // trailing\n}", `{"a": 1}`},
+		{"{\"a\": 1, /* trailing */ }", `{"a": 1}`},
+		{`{"a": ",}"}`, `{"a": ",}"}`},
+	}
+
+	for _, tt := range tests {
+		got := StripComments([]byte(tt.src))
+
+		var gotValue, wantValue interface{}
+		if err := json.Unmarshal(got, &gotValue); err != nil {
+			t.Errorf("StripComments(%q) = %q, invalid JSON: %v", tt.src, got, err)
+			continue
+		}
+		json.Unmarshal([]byte(tt.want), &wantValue)
+
+		if !reflect.DeepEqual(gotValue, wantValue) {
+			t.Errorf("StripComments(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+// writeTree stores files, keyed by slash separated path, as a tree and
+// returns its hash.
+func writeTree(t *testing.T, s *memory.Storage, files map[string]string) plumbing.Hash {
+	t.Helper()
+
+	dirs := make(map[string]map[string]string)
+	tree := &object.Tree{}
+
+	for name, contents := range files {
+		if i := strings.IndexByte(name, '/'); i >= 0 {
+			if dirs[name[:i]] == nil {
+				dirs[name[:i]] = make(map[string]string)
+			}
+			dirs[name[:i]][name[i+1:]] = contents
+			continue
+		}
+
+		blob := s.NewEncodedObject()
+		blob.SetType(plumbing.BlobObject)
+		w, err := blob.Writer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(contents))
+		w.Close()
+
+		hash, err := s.SetEncodedObject(blob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: name, Mode: filemode.Regular, Hash: hash})
+	}
+
+	for dir, contents := range dirs {
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: dir, Mode: filemode.Dir, Hash: writeTree(t, s, contents)})
+	}
+
+	sort.Slice(tree.Entries, func(i, j int) bool {
+		return tree.Entries[i].Name < tree.Entries[j].Name
+	})
+
+	obj := s.NewEncodedObject()
+	err := tree.Encode(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := s.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func TestFind(t *testing.T) {
+	s := memory.NewStorage()
+	tree, err := object.GetTree(s, writeTree(t, s, map[string]string{
+		"tsconfig.json": `{
+			// The root config.
+			"extends": "./tsconfig.base.json",
+			"compilerOptions": {"module": "ESNext",},
+		}`,
+		"tsconfig.base.json": `{
+			"extends": ["@tsconfig/node18/tsconfig.json", "./tsconfig.strict"],
+			"compilerOptions": {
+				"target": "ES2020", /* overrides the configs it extends */
+				"jsx": "react-jsx",
+			},
+		}`,
+		"tsconfig.strict.json":                        `{"compilerOptions": {"strict": true, "target": "ES2022", "useDefineForClassFields": false}}`,
+		"node_modules/@tsconfig/node18/tsconfig.json": `{"compilerOptions": {"moduleResolution": "node16", "target": "es2015"}}`,
+
+		// Each extends the other.
+		"packages/cycle/tsconfig.json":       `{"extends": "./tsconfig.other.json", "compilerOptions": {"target": "es5"}}`,
+		"packages/cycle/tsconfig.other.json": `{"extends": "./tsconfig.json", "compilerOptions": {"target": "es3", "isolatedModules": true}}`,
+
+		// The base isn't committed, or is outside the repository.
+		"packages/missing/tsconfig.json": `{"extends": ["./missing.json", "@scope/missing", "../../../outside.json"], "compilerOptions": {"strict": true}}`,
+
+		"packages/broken/tsconfig.json": `{"compilerOptions": `,
+		"packages/none/src/index.ts":    "",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dir      string
+		wantPath string
+		want     map[string]string
+	}{
+		{"", "tsconfig.json", map[string]string{
+			"target":                  "es2020",
+			"module":                  "esnext",
+			"moduleResolution":        "node16",
+			"strict":                  "true",
+			"useDefineForClassFields": "false",
+			"jsx":                     "react-jsx",
+		}},
+		{"packages/cycle", "packages/cycle/tsconfig.json", map[string]string{
+			"target":          "es5",
+			"isolatedModules": "true",
+		}},
+		{"packages/missing", "packages/missing/tsconfig.json", map[string]string{
+			"strict": "true",
+		}},
+		// A file that can't be parsed is skipped for the one above it.
+		{"packages/broken", "tsconfig.json", nil},
+		{"packages/none/src", "tsconfig.json", nil},
+	}
+
+	l := NewLoader()
+
+	for _, tt := range tests {
+		cfg, err := l.Find(tree, tt.dir)
+		if err != nil {
+			t.Fatalf("Find(%q) error = %v", tt.dir, err)
+		}
+		if cfg == nil {
+			t.Errorf("Find(%q) = nil, want %s", tt.dir, tt.wantPath)
+			continue
+		}
+
+		if cfg.Path != tt.wantPath {
+			t.Errorf("Find(%q).Path = %q, want %q", tt.dir, cfg.Path, tt.wantPath)
+		}
+		if tt.want != nil && !reflect.DeepEqual(cfg.Options, tt.want) {
+			t.Errorf("Find(%q).Options = %v, want %v", tt.dir, cfg.Options, tt.want)
+		}
+	}
+}
+
+func TestFindNone(t *testing.T) {
+	s := memory.NewStorage()
+	tree, err := object.GetTree(s, writeTree(t, s, map[string]string{"src/index.ts": ""}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := NewLoader().Find(tree, "src")
+	if err != nil || cfg != nil {
+		t.Errorf("Find(src) = %v, %v, want nil", cfg, err)
+	}
+}
@@ -0,0 +1,426 @@
+package workspace
+
+import (
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"gopkg.in/yaml.v3"
+)
+
+// Package is a package in a repository, the root package or a member of a
+// workspace.
+type Package struct {
+	// Path is the package's directory relative to the repository root, empty
+	// for the root package.
+	Path string
+	// PackageJson is the contents of the package's package.json. It is empty
+	// for Nx projects that only have a project.json.
+	PackageJson string
+	// Name is the project name from the Nx configuration, used when there is
+	// no package.json.
+	Name string
+}
+
+// Layout is the set of packages in a commit.
+type Layout struct {
+	// Packages are sorted by path, the root package first if there is one.
+	Packages []Package
+}
+
+// Owner returns the index of the package owning filename, the one in the
+// nearest directory above it, or -1 if no package does.
+func (l *Layout) Owner(filename string) int {
+	best, bestLen := -1, -1
+
+	for i, pkg := range l.Packages {
+		if pkg.Path == "" || filename == pkg.Path || strings.HasPrefix(filename, pkg.Path+"/") {
+			if len(pkg.Path) > bestLen {
+				best, bestLen = i, len(pkg.Path)
+			}
+		}
+	}
+
+	return best
+}
+
+// IsRoot reports whether dir is the directory of a package.
+func (l *Layout) IsRoot(dir string) bool {
+	for _, pkg := range l.Packages {
+		if pkg.Path == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains reports whether dir is, or is above, the directory of a package
+// other than the root package.
+func (l *Layout) Contains(dir string) bool {
+	for _, pkg := range l.Packages {
+		if pkg.Path != "" && (pkg.Path == dir || strings.HasPrefix(pkg.Path, dir+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+type rootPackageJson struct {
+	// Workspaces is a list of globs for npm, yarn and bun, or an object
+	// with a packages list for yarn classic.
+	Workspaces json.RawMessage `json:"workspaces"`
+}
+
+type lernaJson struct {
+	Packages      []string `json:"packages"`
+	UseWorkspaces bool     `json:"useWorkspaces"`
+}
+
+type pnpmWorkspace struct {
+	Packages []string `yaml:"packages"`
+}
+
+// nxWorkspace is workspace.json or angular.json. Each project is either its
+// root directory or an object with a root field.
+type nxWorkspace struct {
+	Projects map[string]json.RawMessage `json:"projects"`
+}
+
+type nxProject struct {
+	Root string `json:"root"`
+	Name string `json:"name"`
+}
+
+// nxDefaultGlobs are where Nx puts projects when nothing lists them.
+var nxDefaultGlobs = []string{"apps/*", "libs/*", "packages/*"}
+
+// Find works out the packages in tree. A repository without any workspace
+// configuration has only the root package. It returns an empty layout when
+// there is no package.json at the root and no workspace either.
+func Find(tree *object.Tree) (*Layout, error) {
+	l := &Layout{}
+
+	rootJson, err := readFile(tree, "package.json")
+	if err != nil {
+		return nil, err
+	}
+
+	if rootJson != "" {
+		l.Packages = append(l.Packages, Package{PackageJson: rootJson})
+	}
+
+	globs, kind, err := findGlobs(tree, rootJson)
+	if err != nil {
+		return nil, err
+	}
+
+	if kind == "nx-projects" {
+		err = l.addNxProjects(tree)
+		if err != nil {
+			return nil, err
+		}
+	} else if len(globs) > 0 {
+		err = l.addGlobs(tree, globs, kind == "nx")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(l.Packages, func(i, j int) bool {
+		return l.Packages[i].Path < l.Packages[j].Path
+	})
+
+	return l, nil
+}
+
+// findGlobs returns the workspace globs and the tool they came from. Nx
+// workspaces listing their projects return "nx-projects" and no globs.
+func findGlobs(tree *object.Tree, rootJson string) ([]string, string, error) {
+	if rootJson != "" {
+		var root rootPackageJson
+		if json.Unmarshal([]byte(rootJson), &root) == nil && len(root.Workspaces) > 0 {
+			var globs []string
+			if json.Unmarshal(root.Workspaces, &globs) != nil {
+				var yarn struct {
+					Packages []string `json:"packages"`
+				}
+				json.Unmarshal(root.Workspaces, &yarn)
+				globs = yarn.Packages
+			}
+
+			if len(globs) > 0 {
+				return globs, "npm", nil
+			}
+		}
+	}
+
+	contents, err := readFile(tree, "pnpm-workspace.yaml")
+	if err != nil {
+		return nil, "", err
+	}
+	if contents != "" {
+		var pnpm pnpmWorkspace
+		if yaml.Unmarshal([]byte(contents), &pnpm) == nil && len(pnpm.Packages) > 0 {
+			return pnpm.Packages, "pnpm", nil
+		}
+	}
+
+	contents, err = readFile(tree, "lerna.json")
+	if err != nil {
+		return nil, "", err
+	}
+	if contents != "" {
+		var lerna lernaJson
+		if json.Unmarshal([]byte(contents), &lerna) == nil {
+			if len(lerna.Packages) == 0 {
+				lerna.Packages = []string{"packages/*"}
+			}
+			return lerna.Packages, "lerna", nil
+		}
+	}
+
+	for _, name := range []string{"workspace.json", "angular.json"} {
+		if exists(tree, name) {
+			return nil, "nx-projects", nil
+		}
+	}
+
+	if exists(tree, "nx.json") {
+		return nxDefaultGlobs, "nx", nil
+	}
+
+	return nil, "", nil
+}
+
+// addGlobs adds every directory matching globs that has a package.json, or
+// with nx a project.json. Globs starting with ! exclude directories.
+func (l *Layout) addGlobs(tree *object.Tree, globs []string, nx bool) error {
+	var include, exclude []string
+	for _, glob := range globs {
+		glob = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(glob), "./"), "/")
+		if strings.HasPrefix(glob, "!") {
+			exclude = append(exclude, strings.TrimPrefix(strings.TrimPrefix(glob, "!"), "./"))
+		} else if glob != "" {
+			include = append(include, glob)
+		}
+	}
+
+	seen := make(map[string]bool)
+
+	for _, glob := range include {
+		dirs, err := expand(tree, "", strings.Split(glob, "/"))
+		if err != nil {
+			return err
+		}
+
+	dirs:
+		for _, dir := range dirs {
+			if dir == "" || seen[dir] {
+				continue
+			}
+			for _, ex := range exclude {
+				if match(strings.Split(ex, "/"), strings.Split(dir, "/")) {
+					continue dirs
+				}
+			}
+
+			pkg, ok, err := readPackage(tree, dir, nx)
+			if err != nil {
+				return err
+			}
+			if ok {
+				seen[dir] = true
+				l.Packages = append(l.Packages, pkg)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (l *Layout) addNxProjects(tree *object.Tree) error {
+	for _, name := range []string{"workspace.json", "angular.json"} {
+		contents, err := readFile(tree, name)
+		if err != nil {
+			return err
+		}
+		if contents == "" {
+			continue
+		}
+
+		var ws nxWorkspace
+		if json.Unmarshal([]byte(contents), &ws) != nil {
+			continue
+		}
+
+		names := make([]string, 0, len(ws.Projects))
+		for name := range ws.Projects {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			var root string
+			if json.Unmarshal(ws.Projects[name], &root) != nil {
+				var project nxProject
+				json.Unmarshal(ws.Projects[name], &project)
+				root = project.Root
+			}
+
+			root = strings.Trim(path.Clean(root), "/")
+			if root == "" || root == "." {
+				continue
+			}
+
+			pkgJson, err := readFile(tree, path.Join(root, "package.json"))
+			if err != nil {
+				return err
+			}
+
+			l.Packages = append(l.Packages, Package{Path: root, PackageJson: pkgJson, Name: name})
+		}
+
+		return nil
+	}
+
+	return nil
+}
+
+func readPackage(tree *object.Tree, dir string, nx bool) (Package, bool, error) {
+	pkgJson, err := readFile(tree, path.Join(dir, "package.json"))
+	if err != nil {
+		return Package{}, false, err
+	}
+	if pkgJson != "" {
+		return Package{Path: dir, PackageJson: pkgJson}, true, nil
+	}
+
+	if !nx {
+		return Package{}, false, nil
+	}
+
+	projectJson, err := readFile(tree, path.Join(dir, "project.json"))
+	if err != nil || projectJson == "" {
+		return Package{}, false, err
+	}
+
+	var project nxProject
+	json.Unmarshal([]byte(projectJson), &project)
+	if project.Name == "" {
+		project.Name = path.Base(dir)
+	}
+
+	return Package{Path: dir, Name: project.Name}, true, nil
+}
+
+// expand returns the directories below dir matching the glob segments.
+func expand(tree *object.Tree, dir string, segments []string) ([]string, error) {
+	if len(segments) == 0 {
+		return []string{dir}, nil
+	}
+
+	seg := segments[0]
+
+	if seg == "**" {
+		// Zero directories, or one more and ** again.
+		ret, err := expand(tree, dir, segments[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ent := range tree.Entries {
+			if ent.Mode != filemode.Dir || ent.Name == "node_modules" || strings.HasPrefix(ent.Name, ".") {
+				continue
+			}
+
+			subtree, err := tree.Tree(ent.Name)
+			if err == object.ErrDirectoryNotFound {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+
+			more, err := expand(subtree, path.Join(dir, ent.Name), segments)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, more...)
+		}
+
+		return ret, nil
+	}
+
+	var ret []string
+
+	for _, ent := range tree.Entries {
+		if ent.Mode != filemode.Dir {
+			continue
+		}
+		if ok, _ := path.Match(seg, ent.Name); !ok {
+			continue
+		}
+
+		subtree, err := tree.Tree(ent.Name)
+		if err == object.ErrDirectoryNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		more, err := expand(subtree, path.Join(dir, ent.Name), segments[1:])
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, more...)
+	}
+
+	return ret, nil
+}
+
+// match reports whether the path segments match the glob segments.
+func match(glob []string, segments []string) bool {
+	if len(glob) == 0 {
+		return len(segments) == 0
+	}
+
+	if glob[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if match(glob[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+
+	if ok, _ := path.Match(glob[0], segments[0]); !ok {
+		return false
+	}
+
+	return match(glob[1:], segments[1:])
+}
+
+func exists(tree *object.Tree, name string) bool {
+	_, err := tree.FindEntry(name)
+	return err == nil
+}
+
+// readFile returns the contents of the file at name or an empty string if
+// there isn't one.
+func readFile(tree *object.Tree, name string) (string, error) {
+	file, err := tree.File(name)
+	if err == object.ErrFileNotFound || err == plumbing.ErrObjectNotFound {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	return file.Contents()
+}
@@ -0,0 +1,285 @@
+package workspace
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// writeTree stores files, keyed by slash separated path, as a tree and
+// returns its hash.
+func writeTree(t *testing.T, s *memory.Storage, files map[string]string) plumbing.Hash {
+	t.Helper()
+
+	dirs := make(map[string]map[string]string)
+	tree := &object.Tree{}
+
+	for name, contents := range files {
+		if i := strings.IndexByte(name, '/'); i >= 0 {
+			dir := name[:i]
+			if dirs[dir] == nil {
+				dirs[dir] = make(map[string]string)
+			}
+			dirs[dir][name[i+1:]] = contents
+			continue
+		}
+
+		blob := s.NewEncodedObject()
+		blob.SetType(plumbing.BlobObject)
+		w, err := blob.Writer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(contents))
+		w.Close()
+
+		hash, err := s.SetEncodedObject(blob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: name, Mode: filemode.Regular, Hash: hash})
+	}
+
+	for dir, contents := range dirs {
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: dir, Mode: filemode.Dir, Hash: writeTree(t, s, contents)})
+	}
+
+	sort.Slice(tree.Entries, func(i, j int) bool {
+		return tree.Entries[i].Name < tree.Entries[j].Name
+	})
+
+	obj := s.NewEncodedObject()
+	err := tree.Encode(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := s.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func makeTree(t *testing.T, files map[string]string) (*memory.Storage, *object.Tree) {
+	t.Helper()
+
+	s := memory.NewStorage()
+	tree, err := object.GetTree(s, writeTree(t, s, files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, tree
+}
+
+func paths(l *Layout) []string {
+	ret := make([]string, len(l.Packages))
+	for i, pkg := range l.Packages {
+		ret[i] = pkg.Path
+	}
+	return ret
+}
+
+func TestFind(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name:  "single package",
+			files: map[string]string{"package.json": `{"name":"a"}`, "src/index.ts": ""},
+			want:  []string{""},
+		},
+		{
+			name:  "no package",
+			files: map[string]string{"src/index.ts": ""},
+			want:  []string{},
+		},
+		{
+			name: "npm",
+			files: map[string]string{
+				"package.json":             `{"workspaces":["packages/*","tools/cli"]}`,
+				"packages/a/package.json":  `{}`,
+				"packages/b/package.json":  `{}`,
+				"packages/c/README.md":     "",
+				"tools/cli/package.json":   `{}`,
+				"tools/other/package.json": `{}`,
+			},
+			want: []string{"", "packages/a", "packages/b", "tools/cli"},
+		},
+		{
+			name: "yarn classic",
+			files: map[string]string{
+				"package.json":         `{"workspaces":{"packages":["./libs/*/"],"nohoist":["**/x"]}}`,
+				"libs/a/package.json":  `{}`,
+				"other/b/package.json": `{}`,
+			},
+			want: []string{"", "libs/a"},
+		},
+		{
+			name: "excludes",
+			files: map[string]string{
+				"package.json":                   `{"workspaces":["packages/*","!packages/internal","!**/fixtures"]}`,
+				"packages/a/package.json":        `{}`,
+				"packages/internal/package.json": `{}`,
+				"packages/fixtures/package.json": `{}`,
+			},
+			want: []string{"", "packages/a"},
+		},
+		{
+			name: "double star",
+			files: map[string]string{
+				"package.json":                           `{"workspaces":["packages/**"]}`,
+				"packages/package.json":                  `{}`,
+				"packages/a/package.json":                `{}`,
+				"packages/group/b/package.json":          `{}`,
+				"packages/a/node_modules/x/package.json": `{}`,
+				"packages/.hidden/package.json":          `{}`,
+			},
+			want: []string{"", "packages", "packages/a", "packages/group/b"},
+		},
+		{
+			name: "pnpm",
+			files: map[string]string{
+				"package.json":             `{}`,
+				"pnpm-workspace.yaml":      "packages:\n  - 'apps/*'\n  - '!apps/legacy'\n",
+				"apps/web/package.json":    `{}`,
+				"apps/legacy/package.json": `{}`,
+			},
+			want: []string{"", "apps/web"},
+		},
+		{
+			name: "lerna",
+			files: map[string]string{
+				"lerna.json":              `{"version":"1.0.0","packages":["modules/*"]}`,
+				"modules/a/package.json":  `{}`,
+				"packages/b/package.json": `{}`,
+			},
+			want: []string{"modules/a"},
+		},
+		{
+			name: "lerna default",
+			files: map[string]string{
+				"package.json":            `{}`,
+				"lerna.json":              `{"version":"1.0.0"}`,
+				"packages/b/package.json": `{}`,
+			},
+			want: []string{"", "packages/b"},
+		},
+		{
+			name: "nx default globs",
+			files: map[string]string{
+				"package.json":          `{}`,
+				"nx.json":               `{}`,
+				"apps/web/project.json": `{"name":"web-app"}`,
+				"libs/ui/package.json":  `{}`,
+				"tools/x/project.json":  `{}`,
+			},
+			want: []string{"", "apps/web", "libs/ui"},
+		},
+		{
+			name: "nx workspace.json",
+			files: map[string]string{
+				"package.json":         `{}`,
+				"workspace.json":       `{"projects":{"web":"apps/web","ui":{"root":"libs/ui/"}}}`,
+				"apps/web/index.ts":    "",
+				"libs/ui/package.json": `{}`,
+			},
+			want: []string{"", "apps/web", "libs/ui"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, tree := makeTree(t, tt.files)
+
+			l, err := Find(tree)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := paths(l); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Find() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindNxNames(t *testing.T) {
+	_, tree := makeTree(t, map[string]string{
+		"nx.json":               `{}`,
+		"apps/web/project.json": `{"name":"web-app"}`,
+		"libs/ui/project.json":  `{}`,
+	})
+
+	l, err := Find(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Package{{Path: "apps/web", Name: "web-app"}, {Path: "libs/ui", Name: "ui"}}
+	if !reflect.DeepEqual(l.Packages, want) {
+		t.Errorf("Find() = %+v, want %+v", l.Packages, want)
+	}
+}
+
+// TestFindMissingTree checks a directory whose tree object is missing, as in
+// a partial clone, is skipped.
+func TestFindMissingTree(t *testing.T) {
+	s, tree := makeTree(t, map[string]string{
+		"package.json":            `{"workspaces":["packages/*","**/lib"]}`,
+		"packages/a/package.json": `{"name":"a"}`,
+		"packages/b/package.json": `{"name":"b"}`,
+	})
+
+	packages, err := tree.Tree("packages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := packages.Entries[1].Hash
+	delete(s.ObjectStorage.Objects, missing)
+	delete(s.ObjectStorage.Trees, missing)
+
+	l, err := Find(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := paths(l), []string{"", "packages/a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Find() = %q, want %q", got, want)
+	}
+}
+
+func TestOwner(t *testing.T) {
+	l := &Layout{Packages: []Package{{Path: ""}, {Path: "packages/a"}, {Path: "packages/a/nested"}, {Path: "packages/ab"}}}
+
+	tests := []struct {
+		filename string
+		want     int
+	}{
+		{"index.ts", 0},
+		{"packages/a/index.ts", 1},
+		{"packages/a/nested/index.ts", 2},
+		{"packages/ab/index.ts", 3},
+		{"packages/abc/index.ts", 0},
+		{"packages/a", 1},
+	}
+
+	for _, tt := range tests {
+		if got := l.Owner(tt.filename); got != tt.want {
+			t.Errorf("Owner(%q) = %d, want %d", tt.filename, got, tt.want)
+		}
+	}
+
+	l = &Layout{Packages: []Package{{Path: "packages/a"}}}
+	if got := l.Owner("src/index.ts"); got != -1 {
+		t.Errorf("Owner(src/index.ts) = %d without a root package, want -1", got)
+	}
+}
@@ -1,4 +1,5 @@
 import * as http from 'http';
+import * as readline from 'readline';
 import ts from 'typescript';
 
 function getBody(req: http.IncomingMessage): Promise<string> {
@@ -23,31 +24,148 @@ function getBody(req: http.IncomingMessage): Promise<string> {
 interface Request {
   filename: string;
   fileContents: string;
+  // kind is the file's extension without the dot, it defaults to ts.
+  kind?: string;
+  // matches asks for every match of every feature in the response.
+  matches?: boolean;
 }
 
-const CURRENT_VERSION = 2;
+// CURRENT_VERSION is the protocol version, bump it when requests or
+// responses change shape.
+const CURRENT_VERSION = 6;
+
+// DETECTOR_VERSION identifies the behaviour of gatherFeatures, bump it
+// whenever a detector is added or changes what it matches.
+const DETECTOR_VERSION = 1;
+
+// DETECTORS lists every feature gatherFeatures can report.
+const DETECTORS = [
+  'AccessorKeyword',
+  'SatisfiesExpression',
+  'ExtendsConstraintOnInfer',
+  'VarianceAnnotationsOnTypeParameter',
+  'TypeModifierOnImportName',
+  'ImportAssertion',
+  'StaticBlockInClass',
+  'OverrideOnClassMethod',
+  'AbstractConstructSignature',
+  'TemplateLiteralType',
+  'RemappedNameInMappedType',
+  'NamedTupleMember',
+  'ShortCircuitAssignment',
+];
+
+// Position is a 1-based line and column, counted in UTF-16 code units like
+// TypeScript does.
+interface Position {
+  line: number;
+  column: number;
+}
+
+// SNIPPET_LENGTH is the most UTF-16 code units of a line a match's snippet
+// holds.
+const SNIPPET_LENGTH = 120;
+
+interface Match {
+  feature: string;
+  line: number;
+  column: number;
+  // snippet is the line the match starts on without its line break.
+  snippet: string;
+}
 
 interface Response {
   version: number;
   processTime: number;
   features: Record<string, boolean>;
+  counts: Record<string, number>;
+  // first is where each feature found first appears.
+  first: Record<string, Position>;
+  // matches lists every match in source order if the request asked.
+  matches?: Match[];
+  error?: string;
+}
+
+interface BatchRequest {
+  requests: Request[];
+}
+
+interface BatchResponse {
+  responses: Response[];
+}
+
+interface Version {
+  protocol: number;
+  detectorVersion: number;
+  detectors: string[];
+  typescript: string;
+}
+
+interface Health {
+  status: string;
+  version: number;
+  rss: number;
+}
+
+interface Gathered {
+  counts: Record<string, number>;
+  first: Record<string, Position>;
+  matches?: Match[];
+}
+
+// snippet returns the text of a 0-based line without its line break.
+function snippet(sourceFile: ts.SourceFile, line: number): string {
+  const starts = sourceFile.getLineStarts();
+  const end =
+    line + 1 < starts.length ? starts[line + 1] : sourceFile.text.length;
+  return sourceFile.text
+    .slice(starts[line], end)
+    .replace(/[\r\n\u2028\u2029]+$/, '')
+    .slice(0, SNIPPET_LENGTH);
 }
 
-function gatherFeatures(sourceFile: ts.SourceFile): Record<string, boolean> {
-  const ret: Record<string, boolean> = {};
+function gatherFeatures(
+  sourceFile: ts.SourceFile,
+  withMatches: boolean
+): Gathered {
+  const counts: Record<string, number> = {};
+  const first: Record<string, Position> = {};
+  const matches: Match[] | undefined = withMatches ? [] : undefined;
+
+  // The walk is in source order so the first node found for a feature is
+  // the first in the file.
+  const found = (name: string, node: ts.Node) => {
+    counts[name] = (counts[name] || 0) + 1;
+    if (first[name] !== undefined && matches === undefined) {
+      return;
+    }
+
+    const {line, character} = sourceFile.getLineAndCharacterOfPosition(
+      node.getStart(sourceFile)
+    );
+    if (first[name] === undefined) {
+      first[name] = {line: line + 1, column: character + 1};
+    }
+    matches?.push({
+      feature: name,
+      line: line + 1,
+      column: character + 1,
+      snippet: snippet(sourceFile, line),
+    });
+  };
 
   const walkNode = (node: ts.Node) => {
     if (ts.isSatisfiesExpression(node)) {
-      ret['SatisfiesExpression'] = true;
+      found('SatisfiesExpression', node);
     } else if (ts.isPropertyDeclaration(node)) {
       for (const mod of node.modifiers || []) {
         if (mod.kind === ts.SyntaxKind.AccessorKeyword) {
-          ret['AccessorKeyword'] = true;
+          found('AccessorKeyword', node);
         }
       }
     } else if (ts.isInferTypeNode(node)) {
       if (node.typeParameter.constraint !== undefined) {
-        ret['ExtendsConstraintOnInfer'] = true;
+        found('ExtendsConstraintOnInfer', node);
       }
     } else if (ts.isTypeParameterDeclaration(node)) {
       for (const mod of node.modifiers || []) {
@@ -55,44 +173,44 @@ function gatherFeatures(sourceFile: ts.SourceFile): Record<string, boolean> {
           mod.kind === ts.SyntaxKind.OutKeyword ||
           mod.kind === ts.SyntaxKind.InKeyword
         ) {
-          ret['VarianceAnnotationsOnTypeParameter'] = true;
+          found('VarianceAnnotationsOnTypeParameter', node);
         }
       }
     } else if (ts.isImportSpecifier(node)) {
       if (node.isTypeOnly) {
-        ret['TypeModifierOnImportName'] = true;
+        found('TypeModifierOnImportName', node);
       }
     } else if (ts.isImportDeclaration(node)) {
       if (node.assertClause !== undefined) {
-        ret['ImportAssertion'] = true;
+        found('ImportAssertion', node);
       }
     } else if (ts.isClassStaticBlockDeclaration(node)) {
-      ret['StaticBlockInClass'] = true;
+      found('StaticBlockInClass', node);
     } else if (ts.isMethodDeclaration(node)) {
       for (const mod of node.modifiers || []) {
         if (mod.kind === ts.SyntaxKind.OverrideKeyword) {
-          ret['OverrideOnClassMethod'] = true;
+          found('OverrideOnClassMethod', node);
         }
       }
     } else if (ts.isConstructorTypeNode(node)) {
       for (const mod of node.modifiers || []) {
         if (mod.kind === ts.SyntaxKind.AbstractKeyword) {
-          ret['AbstractConstructSignature'] = true;
+          found('AbstractConstructSignature', node);
         }
       }
     } else if (ts.isTemplateLiteralTypeNode(node)) {
-      ret['TemplateLiteralType'] = true;
+      found('TemplateLiteralType', node);
     } else if (ts.isMappedTypeNode(node) && node.nameType !== undefined) {
-      ret['RemappedNameInMappedType'] = true;
+      found('RemappedNameInMappedType', node);
     } else if (ts.isNamedTupleMember(node)) {
-      ret['NamedTupleMember'] = true;
+      found('NamedTupleMember', node);
     } else if (ts.isBinaryExpression(node)) {
       if (
         node.operatorToken.kind === ts.SyntaxKind.QuestionQuestionEqualsToken ||
         node.operatorToken.kind === ts.SyntaxKind.BarBarEqualsToken ||
         node.operatorToken.kind === ts.SyntaxKind.AmpersandAmpersandEqualsToken
       ) {
-        ret['ShortCircuitAssignment'] = true;
+        found('ShortCircuitAssignment', node);
       }
     }
 
@@ -101,12 +219,17 @@ function gatherFeatures(sourceFile: ts.SourceFile): Record<string, boolean> {
 
   walkNode(sourceFile);
 
-  return ret;
+  return {counts, first, matches};
 }
 
-async function processRequest(body: string): Promise<string> {
-  const request: Request = JSON.parse(body);
+const SCRIPT_KINDS: Record<string, ts.ScriptKind> = {
+  ts: ts.ScriptKind.TS,
+  tsx: ts.ScriptKind.TSX,
+  mts: ts.ScriptKind.TS,
+  cts: ts.ScriptKind.TS,
+};
 
+function analyse(request: Request): Response {
   const start = process.hrtime.bigint();
 
   const sourceFile = ts.createSourceFile(
@@ -114,22 +237,80 @@ async function processRequest(body: string): Promise<string> {
     request.fileContents,
     ts.ScriptTarget.Latest,
     true,
-    ts.ScriptKind.TS
+    SCRIPT_KINDS[request.kind || 'ts'] ?? ts.ScriptKind.TS
   );
 
-  const features = gatherFeatures(sourceFile);
+  const {counts, first, matches} = gatherFeatures(
+    sourceFile,
+    request.matches === true
+  );
 
   const end = process.hrtime.bigint();
 
-  const response: Response = {
+  const features: Record<string, boolean> = {};
+  for (const name of Object.keys(counts)) {
+    features[name] = true;
+  }
+
+  return {
     version: CURRENT_VERSION,
     processTime: Number(end - start),
     features,
+    counts,
+    first,
+    matches,
   };
+}
+
+async function processRequest(request: Request): Promise<Response> {
+  return analyse(request);
+}
+
+async function processBatch(batch: BatchRequest): Promise<BatchResponse> {
+  // A file that fails to process only fails its own entry in the batch.
+  const responses = batch.requests.map(request => {
+    try {
+      return analyse(request);
+    } catch (err) {
+      return {
+        version: CURRENT_VERSION,
+        processTime: 0,
+        features: {},
+        counts: {},
+        first: {},
+        error: String(err),
+      };
+    }
+  });
 
-  return JSON.stringify(response);
+  return {responses};
 }
 
+async function health(): Promise<Health> {
+  return {
+    status: 'ok',
+    version: CURRENT_VERSION,
+    rss: process.memoryUsage().rss,
+  };
+}
+
+async function version(): Promise<Version> {
+  return {
+    protocol: CURRENT_VERSION,
+    detectorVersion: DETECTOR_VERSION,
+    detectors: DETECTORS,
+    typescript: ts.version,
+  };
+}
+
+// eslint-disable-next-line @typescript-eslint/no-explicit-any
+const routes: Record<string, (params: any) => Promise<unknown>> = {
+  process: processRequest,
+  processBatch: processBatch,
+  health: health,
+  version: version,
+};
+
 function asyncWrap(
   func: (req: http.IncomingMessage, res: http.ServerResponse) => Promise<void>
 ): http.RequestListener<
@@ -146,17 +327,84 @@ function asyncWrap(
   };
 }
 
-const server = http.createServer(
-  asyncWrap(async (req, res) => {
-    const body = await getBody(req);
-    const response = await processRequest(body);
-    res.writeHead(200, undefined, {
-      'Content-Type': 'application/json',
-    });
-    res.end(response);
-  })
-);
+function serveHttp() {
+  const server = http.createServer(
+    asyncWrap(async (req, res) => {
+      const handler = routes[(req.url || '').slice(1)];
+      if (handler === undefined) {
+        res.writeHead(404, 'Not Found', {
+          'Content-Type': 'application/json',
+        });
+        res.end(JSON.stringify({Error: `unknown path: ${req.url}`}));
+        return;
+      }
+
+      const body = await getBody(req);
+      const params = body === '' ? undefined : JSON.parse(body);
+      const response = await handler(params);
+      res.writeHead(200, undefined, {
+        'Content-Type': 'application/json',
+      });
+      res.end(JSON.stringify(response));
+    })
+  );
+
+  const port = Number(process.env.PORT || 5123);
 
-console.log('Listening on http://localhost:5123/');
+  server.listen(port, () => {
+    console.log(`Listening on http://localhost:${port}/`);
+  });
+}
 
-server.listen(5123);
+interface StdioRequest {
+  id: number;
+  method: string;
+  params?: unknown;
+}
+
+// serveStdio reads one JSON request per line from stdin and writes one
+// response per line to stdout, tagged with the request's id. The process
+// exits once stdin is closed and every request has been answered.
+function serveStdio() {
+  // stdout carries responses so anything logged has to go elsewhere.
+  console.log = console.error;
+
+  const send = (message: object) => {
+    process.stdout.write(JSON.stringify(message) + '\n');
+  };
+
+  const lines = readline.createInterface({
+    input: process.stdin,
+    crlfDelay: Infinity,
+  });
+
+  lines.on('line', line => {
+    let request: StdioRequest;
+    try {
+      request = JSON.parse(line);
+    } catch (err) {
+      console.error(`invalid request: ${err}`);
+      return;
+    }
+
+    const handler = routes[request.method];
+    if (handler === undefined) {
+      send({
+        id: request.id,
+        error: `unknown method: ${request.method}`,
+        status: 404,
+      });
+      return;
+    }
+
+    handler(request.params)
+      .then(result => send({id: request.id, result}))
+      .catch(err => send({id: request.id, error: String(err), status: 500}));
+  });
+}
+
+if (process.argv.includes('--stdio')) {
+  serveStdio();
+} else {
+  serveHttp();
+}
@@ -110,20 +110,67 @@ def b(s: str) -> bool:
 
 def read_csv(filename) -> List[Row]:
     ret = []
+    unknown = 0
 
     with open(filename) as f:
         r = csv.reader(f)
         for id, commit_hash, pkg_name, pkg_version, ts_version, commit_time, total_files, *rest in r:
+            # Features the detector can't find, such as most of them with
+            # -detector native, are empty rather than 0. Those rows can't
+            # tell when a feature was adopted.
+            if "" in rest[:len(FEATURE_RELEASE_DATES)]:
+                unknown += 1
+                continue
+
             ret.append(Row(
                 id, commit_hash, pkg_name, pkg_version, ts_version,
                 int(total_files),
                 datetime.datetime.fromtimestamp(int(commit_time)),
-                *[b(i) for i in rest]
+                *[b(i) for i in rest[:len(FEATURE_RELEASE_DATES)]]
             ))
 
+    if unknown > 0:
+        logging.warning(
+            "%s: skipped %d rows from a detector that can't find every feature.", filename, unknown)
+
     return ret
 
 
+@dataclass
+class Commit:
+    id: str
+    commit_hash: str
+    # ts_versions holds every package's TypeScript version, without empty
+    # ones.
+    ts_versions: set[str]
+    total_files: int
+    commit_time: datetime.datetime
+    flags: dict[str, bool]
+
+
+def merge_packages(rows: List[Row]) -> List[Commit]:
+    """Combines the rows collect writes for each package of a commit into one
+    for the whole repository. A feature is present if any package uses it and
+    the file count is the sum over the packages."""
+    commits: dict[tuple[str, str], Commit] = {}
+
+    for row in rows:
+        key = (row.id, row.commit_hash)
+        if key not in commits:
+            commits[key] = Commit(
+                row.id, row.commit_hash, set(), 0, row.commit_time,
+                {k: False for k in FEATURE_RELEASE_DATES})
+        commit = commits[key]
+
+        if row.ts_version != "":
+            commit.ts_versions.add(row.ts_version)
+        commit.total_files += row.total_files
+        for k, v in row.get_flags().items():
+            commit.flags[k] = commit.flags[k] or v
+
+    return list(commits.values())
+
+
 def get_day_delta(a: datetime.datetime, b: datetime.datetime):
     return (a - b).days
 
@@ -171,24 +218,28 @@ def main(args):
     logging.info("Gathering basic statistics.")
 
     for file in os.listdir(input_path):
+        if not file.endswith(".csv"):
+            continue
         filename = os.path.join(input_path, file)
-        rows = read_csv(filename)
-        for row in rows:
-            row_flags = row.get_flags()
-
-            flag_delta = compute_deltas(
-                row_flags, row.ts_version, row.commit_time)
+        for row in merge_packages(read_csv(filename)):
+            row_flags = row.flags
 
             if row.id not in repo_feature_introduction:
                 repo_feature_introduction[row.id] = {}
             repo = repo_feature_introduction[row.id]
 
-            for k, v in flag_delta.items():
-                if v == None:
-                    continue
-                if k not in repo:
-                    repo[k] = v
-                repo[k] = min(repo[k], v)
+            # Packages of a monorepo can be on different versions, a version
+            # counts as adopted once any package uses it.
+            for ts_version in row.ts_versions or {""}:
+                flag_delta = compute_deltas(
+                    row_flags, ts_version, row.commit_time)
+
+                for k, v in flag_delta.items():
+                    if v == None:
+                        continue
+                    if k not in repo:
+                        repo[k] = v
+                    repo[k] = min(repo[k], v)
 
             update(repo, "total_files", row.total_files, 0, max)
             update(repo, "earliest_commit", row.commit_time.year, 3000, min)